@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"github.com/airlangga-hub/chirpy-go/internal/audit"
+	"github.com/airlangga-hub/chirpy-go/internal/auth"
+	"github.com/airlangga-hub/chirpy-go/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	auditLogin = "user.login"
+	auditLoginFailed = "user.login_failed"
+	auditLoginThrottled = "user.login_throttled"
+	auditUserUpdate = "user.update"
+	auditPasswordChange = "user.password_change"
+	auditPasswordReset = "user.password_reset"
+	auditEmailVerify = "user.email_verify"
+	auditTokenRevoke = "token.revoke"
+	auditPolkaUpgrade = "polka.user_upgraded"
+	auditChirpDelete = "chirp.delete"
+	auditAdminReset = "admin.reset"
+	auditAdminUserSearch = "admin.user.search"
+	auditAdminUserView = "admin.user.view"
+	auditAdminUserRole = "admin.user.role"
+	auditAdminUserPasswordReset = "admin.user.password_reset"
+	auditAdminUserVerifyEmail = "admin.user.verify_email"
+	auditAdminUserChirpyRed = "admin.user.chirpy_red"
+	auditAdminUserDelete = "admin.user.delete"
+	auditAdminUserImpersonate = "admin.user.impersonate"
+	auditImpersonatedRequest = "impersonation.request"
+)
+
+type impersonatorKey struct{}
+
+// withImpersonator marks r as made with an impersonation token held by
+// adminID, so every audit event it records names them.
+func withImpersonator(r *http.Request, adminID uuid.UUID) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), impersonatorKey{}, adminID))
+}
+
+func impersonatorFrom(r *http.Request) uuid.UUID {
+	adminID, _ := r.Context().Value(impersonatorKey{}).(uuid.UUID)
+	return adminID
+}
+
+// auditEvent is one entry for the audit log. ActorID is who did it and
+// TargetID whose account it was done to; uuid.Nil means nobody, like Polka or
+// someone who isn't logged in. Details is stored as JSON, and Diff holds the
+// fields that changed.
+type auditEvent struct {
+	Action string
+	ActorID uuid.UUID
+	TargetID uuid.UUID
+	Details any
+	Diff map[string]audit.Change
+}
+
+// audit writes event to the audit log, with the request's IP address, user
+// agent and, if it was made with an impersonation token, the admin. The
+// action has already happened, so a failed write is logged rather than
+// failing the request.
+func (cfg *apiConfig) audit(r *http.Request, event auditEvent) {
+	impersonatorID := impersonatorFrom(r)
+
+	details, err := json.Marshal(event.Details)
+	if err != nil || event.Details == nil {
+		details = []byte("{}")
+	}
+	diff, err := json.Marshal(event.Diff)
+	if err != nil || event.Diff == nil {
+		diff = []byte("{}")
+	}
+
+	if err := cfg.db.CreateAuditEvent(r.Context(), database.CreateAuditEventParams{
+		ActorID: uuid.NullUUID{UUID: event.ActorID, Valid: event.ActorID != uuid.Nil},
+		Action: event.Action,
+		TargetUserID: uuid.NullUUID{UUID: event.TargetID, Valid: event.TargetID != uuid.Nil},
+		IpAddress: clientIP(r),
+		UserAgent: r.UserAgent(),
+		Details: details,
+		Diff: diff,
+		ImpersonatorID: uuid.NullUUID{UUID: impersonatorID, Valid: impersonatorID != uuid.Nil},
+	}); err != nil {
+		log.Printf("Error writing audit event %s by %s: %s", event.Action, event.ActorID, err)
+	}
+}
+
+// auditImpersonation records a request made with an impersonation token,
+// before anything else is done with it.
+func (cfg *apiConfig) auditImpersonation(r *http.Request, claims auth.Claims) {
+	cfg.audit(r, auditEvent{
+		Action: auditImpersonatedRequest,
+		ActorID: claims.ActorID,
+		TargetID: claims.UserID,
+		Details: map[string]any{
+			"method": r.Method,
+			"path": r.URL.Path,
+			"token_id": claims.ID,
+		},
+	})
+}
+
+// auditDiff lists the fields that changed between before and after, either
+// of which may be nil. updated_at is left out since it changes every time.
+func auditDiff(before, after any) map[string]audit.Change {
+	diff, err := audit.Diff(before, after, "updated_at")
+	if err != nil {
+		log.Printf("Error diffing audit event: %s", err)
+	}
+	return diff
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"github.com/airlangga-hub/chirpy-go/internal/auth"
+	"github.com/airlangga-hub/chirpy-go/internal/database"
+	"github.com/airlangga-hub/chirpy-go/internal/password"
+)
+
+// runBootstrapAdmin makes the first admin, for `chirpy bootstrap-admin
+// EMAIL`. The account with EMAIL is promoted or, if there is none, created
+// with a password read from standard input. Once any admin exists it does
+// nothing; admins change roles through PUT /admin/users/{userID}/role.
+func runBootstrapAdmin(ctx context.Context, dbConn *sql.DB, db *database.Queries, policy password.Policy, args []string) error {
+	if len(args) != 1 {
+		return errors.New("Usage: chirpy bootstrap-admin EMAIL")
+	}
+	email := args[0]
+	if err := validateEmail(email); err != nil {
+		return err
+	}
+
+	tx, err := dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	qtx := db.WithTx(tx)
+
+	admins, err := qtx.CountUsersWithRole(ctx, auth.RoleAdmin)
+	if err != nil {
+		return err
+	}
+	if admins > 0 {
+		return errors.New("An admin already exists; use PUT /admin/users/{userID}/role instead")
+	}
+
+	user, err := qtx.GetUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		user, err = createBootstrapUser(ctx, qtx, policy, email)
+	}
+	if err != nil {
+		return err
+	}
+
+	user, err = qtx.SetUserRole(ctx, database.SetUserRoleParams{
+		Role: auth.RoleAdmin,
+		ID: user.ID,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s (%s) is now an admin\n", user.Email, user.ID)
+	return nil
+}
+
+// createBootstrapUser creates a verified account for the first admin, with a
+// password that has to meet the usual policy.
+func createBootstrapUser(ctx context.Context, db *database.Queries, policy password.Policy, email string) (database.User, error) {
+	fmt.Fprintf(os.Stderr, "No account for %s; enter a password to create one: ", email)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return database.User{}, fmt.Errorf("Couldn't read password: %w", err)
+	}
+	newPassword := strings.TrimRight(line, "\r\n")
+
+	violations, err := policy.Check(newPassword, email)
+	if err != nil {
+		return database.User{}, err
+	}
+	if len(violations) > 0 {
+		return database.User{}, errors.New(violations[0].Message)
+	}
+
+	hashedPassword, err := auth.HashPassword(newPassword)
+	if err != nil {
+		return database.User{}, err
+	}
+
+	user, err := db.CreateUser(ctx, database.CreateUserParams{
+		Email: email,
+		HashedPassword: hashedPassword,
+		Handle: generateHandle(),
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+
+	// The operator vouches for the address, so there is no email to verify.
+	return db.VerifyUserEmail(ctx, database.VerifyUserEmailParams{
+		Email: user.Email,
+		ID: user.ID,
+	})
+}
@@ -0,0 +1,14 @@
+package main
+
+import (
+	"errors"
+	"github.com/lib/pq"
+)
+
+func isUniqueViolation(err error, constraint string) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	return pqErr.Code == "23505" && pqErr.Constraint == constraint
+}
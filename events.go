@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"github.com/airlangga-hub/chirpy-go/internal/pubsub"
+	"github.com/google/uuid"
+)
+
+const (
+	topicHomePrefix = "home:"
+	topicAuthorPrefix = "author:"
+	topicHashtagPrefix = "hashtag:"
+	topicThreadPrefix = "thread:"
+	topicConversationPrefix = "conversation:"
+
+	eventChirpCreated = "chirp.created"
+	eventChirpDeleted = "chirp.deleted"
+	eventTyping = "typing"
+	eventMessageCreated = "message.created"
+	eventConversationRead = "conversation.read"
+)
+
+var (
+	errUnknownTopic = errors.New("Unknown topic")
+	errInvalidTopicID = errors.New("Invalid topic ID")
+)
+
+// homeTopic carries the chirps that belong on a user's home timeline.
+func homeTopic(userID uuid.UUID) string {
+	return topicHomePrefix + userID.String()
+}
+
+func authorTopic(userID uuid.UUID) string {
+	return topicAuthorPrefix + userID.String()
+}
+
+func hashtagTopic(tag string) string {
+	return topicHashtagPrefix + strings.ToLower(tag)
+}
+
+func threadTopic(chirpID uuid.UUID) string {
+	return topicThreadPrefix + chirpID.String()
+}
+
+func conversationTopic(conversationID uuid.UUID) string {
+	return topicConversationPrefix + conversationID.String()
+}
+
+func extractHashtags(body string) []string {
+	seen := map[string]struct{}{}
+	var tags []string
+
+	for _, word := range strings.Fields(body) {
+		if !strings.HasPrefix(word, "#") {
+			continue
+		}
+
+		tag := strings.ToLower(strings.TrimRight(word[1:], ".,!?;:"))
+		if tag == "" {
+			continue
+		}
+
+		if _, exist := seen[tag]; exist {
+			continue
+		}
+		seen[tag] = struct{}{}
+		tags = append(tags, tag)
+	}
+
+	return tags
+}
+
+// chirpTopics lists every topic a chirp event is published to. homeUserIDs
+// are the users whose home timeline the chirp belongs on.
+func chirpTopics(chirp Chirp, homeUserIDs []uuid.UUID) []string {
+	topics := []string{
+		authorTopic(chirp.UserID),
+		threadTopic(chirp.ID),
+	}
+
+	for _, userID := range homeUserIDs {
+		topics = append(topics, homeTopic(userID))
+	}
+
+	for _, tag := range extractHashtags(chirp.Body) {
+		topics = append(topics, hashtagTopic(tag))
+	}
+
+	return topics
+}
+
+// publishChirpEvent fans a chirp event out to the home timelines of its
+// author and their followers. Follows between users who have blocked each
+// other are skipped, so a block also keeps chirps off the timeline.
+func (cfg *apiConfig) publishChirpEvent(ctx context.Context, eventType string, chirp Chirp) {
+	followerIDs, err := cfg.db.GetFollowerIDs(ctx, chirp.UserID)
+	if err != nil {
+		log.Printf("Error getting followers for %s event: %s", eventType, err)
+	}
+
+	for _, topic := range chirpTopics(chirp, append([]uuid.UUID{chirp.UserID}, followerIDs...)) {
+		event, err := pubsub.NewEvent(topic, eventType, chirp)
+		if err != nil {
+			log.Printf("Error encoding %s event: %s", eventType, err)
+			return
+		}
+		cfg.publisher.Publish(event)
+	}
+}
+
+func (cfg *apiConfig) publishConversationEvent(conversationID uuid.UUID, eventType string, data any) {
+	event, err := pubsub.NewEvent(conversationTopic(conversationID), eventType, data)
+	if err != nil {
+		log.Printf("Error encoding %s event: %s", eventType, err)
+		return
+	}
+	cfg.publisher.Publish(event)
+}
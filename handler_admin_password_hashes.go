@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"github.com/airlangga-hub/chirpy-go/internal/auth"
+)
+
+// handlerAdminPasswordHashes reports how many password hashes use each set
+// of argon2id parameters, to show how far an upgrade has got. Hashes are only
+// upgraded when their owner logs in.
+func (cfg *apiConfig) handlerAdminPasswordHashes(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
+	type paramsCount struct {
+		Params string `json:"params"`
+		Users int64 `json:"users"`
+		Current bool `json:"current"`
+	}
+	type response struct {
+		CurrentParams string `json:"current_params"`
+		Current int64 `json:"current"`
+		Outdated int64 `json:"outdated"`
+		ByParams []paramsCount `json:"by_params"`
+	}
+
+	counts, err := cfg.db.CountPasswordHashesByParams(r.Context())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't count password hashes", err)
+		return
+	}
+
+	resp := response{
+		CurrentParams: auth.EncodedPasswordParams(auth.PasswordParams),
+		ByParams: make([]paramsCount, 0, len(counts)),
+	}
+
+	for _, count := range counts {
+		current := count.Params == resp.CurrentParams
+		if current {
+			resp.Current += count.Users
+		} else {
+			resp.Outdated += count.Users
+		}
+		resp.ByParams = append(resp.ByParams, paramsCount{
+			Params: count.Params,
+			Users: count.Users,
+			Current: current,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"github.com/airlangga-hub/chirpy-go/internal/auth"
+	"github.com/airlangga-hub/chirpy-go/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	adminUserSearchDefaultLimit = 20
+	adminUserSearchMaxLimit = 100
+	impersonationTokenTTL = 15 * time.Minute
+)
+
+// AdminUser is everything an admin sees about an account.
+type AdminUser struct {
+	User
+	ChirpCount int64 `json:"chirp_count"`
+	Sessions []Session `json:"sessions"`
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// handlerAdminUsersSearch finds users whose email or handle contains q.
+func (cfg *apiConfig) handlerAdminUsersSearch(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		respondWithError(w, http.StatusBadRequest, "Search query q is required", nil)
+		return
+	}
+
+	limit := adminUserSearchDefaultLimit
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > adminUserSearchMaxLimit {
+			respondWithError(w, http.StatusBadRequest, "limit must be between 1 and 100", err)
+			return
+		}
+		limit = n
+	}
+
+	rows, err := cfg.db.SearchUsers(r.Context(), database.SearchUsersParams{
+		Pattern: "%" + likeEscaper.Replace(query) + "%",
+		MaxResults: int32(limit),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't search users", err)
+		return
+	}
+
+	cfg.audit(r, auditEvent{
+		Action: auditAdminUserSearch,
+		ActorID: claims.UserID,
+		Details: map[string]any{"query": query},
+	})
+
+	users := make([]User, 0, len(rows))
+	for _, row := range rows {
+		users = append(users, cfg.userFromDB(row))
+	}
+
+	respondWithJSON(w, http.StatusOK, users)
+}
+
+func (cfg *apiConfig) handlerAdminUserGet(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
+	user, ok := cfg.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	chirpCount, err := cfg.db.CountChirpsByUser(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't count chirps", err)
+		return
+	}
+
+	sessions, err := cfg.db.GetSessionsForUser(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get sessions", err)
+		return
+	}
+
+	cfg.audit(r, auditEvent{
+		Action: auditAdminUserView,
+		ActorID: claims.UserID,
+		TargetID: user.ID,
+	})
+
+	respondWithJSON(w, http.StatusOK, AdminUser{
+		User: cfg.userFromDB(user),
+		ChirpCount: chirpCount,
+		Sessions: sessionsFromDB(sessions),
+	})
+}
+
+// handlerAdminUserRole changes a user's role. Admins can't change their own,
+// so there is always at least one admin left.
+func (cfg *apiConfig) handlerAdminUserRole(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
+	type parameters struct {
+		Role string `json:"role"`
+	}
+
+	user, ok := cfg.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	var params parameters
+
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
+		return
+	}
+
+	if !auth.ValidRole(params.Role) {
+		respondWithError(w, http.StatusBadRequest, "Role must be user, moderator or admin", nil)
+		return
+	}
+	if user.ID == claims.UserID {
+		respondWithError(w, http.StatusForbidden, "You can't change your own role", nil)
+		return
+	}
+
+	updated, err := cfg.db.SetUserRole(r.Context(), database.SetUserRoleParams{
+		Role: params.Role,
+		ID: user.ID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't change role", err)
+		return
+	}
+
+	cfg.audit(r, auditEvent{
+		Action: auditAdminUserRole,
+		ActorID: claims.UserID,
+		TargetID: user.ID,
+		Diff: auditDiff(cfg.userFromDB(user), cfg.userFromDB(updated)),
+	})
+
+	respondWithJSON(w, http.StatusOK, cfg.userFromDB(updated))
+}
+
+// handlerAdminUserPasswordReset forces a password reset: the current
+// password stops working, every session is logged out, and the user is
+// emailed a reset token.
+func (cfg *apiConfig) handlerAdminUserPasswordReset(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
+	user, ok := cfg.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(auth.MakeRefreshToken())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't hash password", err)
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reset password", err)
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := cfg.db.WithTx(tx)
+
+	if err := qtx.UpdateUserPassword(r.Context(), database.UpdateUserPasswordParams{
+		HashedPassword: hashedPassword,
+		ID: user.ID,
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reset password", err)
+		return
+	}
+
+	if err := qtx.RevokeAllRefreshTokensForUser(r.Context(), user.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke sessions", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reset password", err)
+		return
+	}
+
+	if err := cfg.revokeAllAccessTokens(r.Context(), user.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke access tokens", err)
+		return
+	}
+
+	cfg.audit(r, auditEvent{
+		Action: auditAdminUserPasswordReset,
+		ActorID: claims.UserID,
+		TargetID: user.ID,
+	})
+
+	if err := cfg.mailPasswordReset(r.Context(), user); err != nil {
+		respondWithError(w, http.StatusBadGateway, "Password was reset but the email couldn't be sent; the user can use forgot password", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerAdminUserVerifyEmail marks the user's current email as verified.
+// A pending email change is left for the user to confirm.
+func (cfg *apiConfig) handlerAdminUserVerifyEmail(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
+	user, ok := cfg.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	verified, err := cfg.db.VerifyUserEmail(r.Context(), database.VerifyUserEmailParams{
+		Email: user.Email,
+		ID: user.ID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't verify email", err)
+		return
+	}
+
+	cfg.audit(r, auditEvent{
+		Action: auditAdminUserVerifyEmail,
+		ActorID: claims.UserID,
+		TargetID: user.ID,
+		Diff: auditDiff(cfg.userFromDB(user), cfg.userFromDB(verified)),
+	})
+
+	respondWithJSON(w, http.StatusOK, cfg.userFromDB(verified))
+}
+
+// handlerAdminUserChirpyRed grants Chirpy Red on PUT and revokes it on
+// DELETE.
+func (cfg *apiConfig) handlerAdminUserChirpyRed(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
+	user, ok := cfg.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	isChirpyRed := r.Method == http.MethodPut
+
+	updated, err := cfg.db.SetUserChirpyRed(r.Context(), database.SetUserChirpyRedParams{
+		IsChirpyRed: isChirpyRed,
+		ID: user.ID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update Chirpy Red", err)
+		return
+	}
+
+	cfg.audit(r, auditEvent{
+		Action: auditAdminUserChirpyRed,
+		ActorID: claims.UserID,
+		TargetID: user.ID,
+		Diff: auditDiff(cfg.userFromDB(user), cfg.userFromDB(updated)),
+	})
+
+	respondWithJSON(w, http.StatusOK, cfg.userFromDB(updated))
+}
+
+// handlerAdminUserDelete deletes an account and everything it owns. Admins
+// can't delete themselves.
+func (cfg *apiConfig) handlerAdminUserDelete(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
+	user, ok := cfg.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	if user.ID == claims.UserID {
+		respondWithError(w, http.StatusForbidden, "You can't delete your own account here", nil)
+		return
+	}
+
+	if err := cfg.revokeAllAccessTokens(r.Context(), user.ID); err != nil {
+		log.Printf("Error revoking access tokens of deleted user %s: %s", user.ID, err)
+	}
+
+	deleted, err := cfg.db.DeleteUser(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete user", err)
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, http.StatusNotFound, "User not found", nil)
+		return
+	}
+
+	cfg.audit(r, auditEvent{
+		Action: auditAdminUserDelete,
+		ActorID: claims.UserID,
+		TargetID: user.ID,
+		Diff: auditDiff(cfg.userFromDB(user), nil),
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerAdminUserImpersonate mints a short-lived access token that acts as
+// the user, for seeing what they see. The token names the admin in its act
+// claim, can't touch the account itself, and every request made with it is
+// audited.
+func (cfg *apiConfig) handlerAdminUserImpersonate(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
+	type parameters struct {
+		Reason string `json:"reason"`
+	}
+
+	type response struct {
+		User User `json:"user"`
+		Token string `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+
+	user, ok := cfg.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	var params parameters
+
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
+		return
+	}
+
+	params.Reason = strings.TrimSpace(params.Reason)
+	if params.Reason == "" {
+		respondWithError(w, http.StatusBadRequest, "A reason is required", nil)
+		return
+	}
+	if user.ID == claims.UserID {
+		respondWithError(w, http.StatusBadRequest, "You can't impersonate yourself", nil)
+		return
+	}
+
+	tokenID := uuid.NewString()
+	// JWT expiry only has second precision.
+	expiresAt := time.Now().UTC().Add(impersonationTokenTTL).Truncate(time.Second)
+
+	token, err := auth.MakeImpersonationJWT(user.ID, claims.UserID, cfg.jwtKeys, impersonationTokenTTL, tokenID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create impersonation token", err)
+		return
+	}
+
+	cfg.audit(r, auditEvent{
+		Action: auditAdminUserImpersonate,
+		ActorID: claims.UserID,
+		TargetID: user.ID,
+		Details: map[string]any{
+			"reason": params.Reason,
+			"token_id": tokenID,
+			"expires_at": expiresAt,
+		},
+	})
+
+	respondWithJSON(w, http.StatusCreated, response{
+		User: cfg.userFromDB(user),
+		Token: token,
+		ExpiresAt: expiresAt,
+	})
+}
+
+// adminTargetUser loads the user named by the userID path value, responding
+// with an error if there isn't one.
+func (cfg *apiConfig) adminTargetUser(w http.ResponseWriter, r *http.Request) (database.User, bool) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return database.User{}, false
+	}
+
+	user, err := cfg.db.GetUser(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "User not found", err)
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		}
+		return database.User{}, false
+	}
+
+	return user, true
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"github.com/airlangga-hub/chirpy-go/internal/auth"
+	"github.com/airlangga-hub/chirpy-go/internal/database"
+	"github.com/google/uuid"
+)
+
+const maxAPIKeyTTL = 5 * 365 * 24 * time.Hour
+
+// APIKey is a long-lived credential for automation, sent as
+// "Authorization: ApiKey <key>". Key is only set in the response that
+// creates it; afterwards only the prefix identifies it.
+type APIKey struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Key        string     `json:"key,omitempty"`
+}
+
+func apiKeyFromDB(key database.ApiKey) APIKey {
+	apiKey := APIKey{
+		ID: key.ID,
+		CreatedAt: key.CreatedAt,
+		Name: key.Name,
+		Prefix: key.KeyPrefix,
+		Scopes: key.Scopes,
+	}
+	if key.ExpiresAt.Valid {
+		apiKey.ExpiresAt = &key.ExpiresAt.Time
+	}
+	if key.LastUsedAt.Valid {
+		apiKey.LastUsedAt = &key.LastUsedAt.Time
+	}
+	return apiKey
+}
+
+func (cfg *apiConfig) handlerAPIKeysCreate(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
+	type parameters struct {
+		Name string `json:"name"`
+		Scopes []string `json:"scopes"`
+		ExpiresInDays int `json:"expires_in_days"`
+	}
+
+	var params parameters
+
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
+		return
+	}
+
+	name := strings.TrimSpace(params.Name)
+	if name == "" || len(name) > maxTokenNameLength {
+		respondWithError(w, http.StatusBadRequest, "Name must be 1-100 characters", nil)
+		return
+	}
+
+	scopes := params.Scopes
+	if len(scopes) == 0 {
+		scopes = auth.DelegableScopes
+	}
+	if err := auth.ValidateScopes(scopes, auth.DelegableScopes); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	var expiresAt sql.NullTime
+	if params.ExpiresInDays != 0 {
+		ttl := time.Duration(params.ExpiresInDays) * 24 * time.Hour
+		if ttl <= 0 || ttl > maxAPIKeyTTL {
+			respondWithError(w, http.StatusBadRequest, "API keys must expire within 5 years, or never", nil)
+			return
+		}
+		expiresAt = sql.NullTime{Time: time.Now().UTC().Add(ttl), Valid: true}
+	}
+
+	key := auth.MakeAPIKey()
+
+	dbKey, err := cfg.db.CreateAPIKey(r.Context(), database.CreateAPIKeyParams{
+		UserID: claims.UserID,
+		Name: name,
+		KeyHash: auth.HashToken(key),
+		KeyPrefix: key[:len(auth.APIKeyPrefix)+8],
+		Scopes: scopes,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create API key", err)
+		return
+	}
+
+	response := apiKeyFromDB(dbKey)
+	response.Key = key
+
+	respondWithJSON(w, http.StatusCreated, response)
+}
+
+func (cfg *apiConfig) handlerAPIKeysRetrieve(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
+	dbKeys, err := cfg.db.GetAPIKeysForUser(r.Context(), claims.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get API keys", err)
+		return
+	}
+
+	keys := make([]APIKey, 0, len(dbKeys))
+	for _, dbKey := range dbKeys {
+		keys = append(keys, apiKeyFromDB(dbKey))
+	}
+
+	respondWithJSON(w, http.StatusOK, keys)
+}
+
+func (cfg *apiConfig) handlerAPIKeyDelete(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
+	keyID, err := uuid.Parse(r.PathValue("keyID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid API key ID", err)
+		return
+	}
+
+	revoked, err := cfg.db.RevokeAPIKey(r.Context(), database.RevokeAPIKeyParams{
+		ID: keyID,
+		UserID: claims.UserID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke API key", err)
+		return
+	}
+	if revoked == 0 {
+		respondWithError(w, http.StatusNotFound, "API key not found", nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authenticateAPIKey turns a user API key into the same claims an access
+// token would carry, so handlers don't care which one they got.
+func (cfg *apiConfig) authenticateAPIKey(ctx context.Context, key string) (auth.Claims, error) {
+	if !auth.IsUserAPIKey(key) {
+		return auth.Claims{}, errors.New("Not a user API key")
+	}
+
+	dbKey, err := cfg.db.GetAPIKeyByHash(ctx, auth.HashToken(key))
+	if err != nil {
+		return auth.Claims{}, err
+	}
+
+	claims := auth.Claims{
+		UserID: dbKey.UserID,
+		IssuedAt: dbKey.CreatedAt,
+		Scopes: dbKey.Scopes,
+	}
+	if dbKey.ExpiresAt.Valid {
+		claims.ExpiresAt = dbKey.ExpiresAt.Time
+	}
+
+	// Keys made before the user's watermark die with their access tokens, so
+	// logging out everywhere or resetting the password also shuts out a key
+	// minted from a stolen session.
+	if err := auth.CheckRevocation(ctx, cfg.revocations, claims); err != nil {
+		return auth.Claims{}, err
+	}
+
+	if err := cfg.db.TouchAPIKey(ctx, dbKey.ID); err != nil {
+		log.Printf("Error updating API key last use: %s", err)
+	}
+
+	return claims, nil
+}
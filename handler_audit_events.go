@@ -0,0 +1,183 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+	"github.com/airlangga-hub/chirpy-go/internal/auth"
+	"github.com/airlangga-hub/chirpy-go/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	auditEventsDefaultLimit = 50
+	auditEventsMaxLimit = 200
+)
+
+// AuditEvent is one entry in the audit log. Details describe the action and
+// diff holds each changed field as {"from": ..., "to": ...}. Events recorded
+// while an admin was impersonating the user are marked impersonated.
+type AuditEvent struct {
+	ID uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	ActorID *uuid.UUID `json:"actor_id"`
+	Action string `json:"action"`
+	TargetUserID *uuid.UUID `json:"target_user_id"`
+	IPAddress string `json:"ip_address,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+	Details json.RawMessage `json:"details"`
+	Diff json.RawMessage `json:"diff"`
+	Impersonated bool `json:"impersonated"`
+	ImpersonatorID *uuid.UUID `json:"impersonator_id,omitempty"`
+}
+
+// handlerAdminAuditEvents lists audit events, newest first, filtered by
+// actor_id, target_user_id, impersonator_id, action, and a since/until time
+// range. To page back, pass the created_at of the last event as until.
+func (cfg *apiConfig) handlerAdminAuditEvents(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
+	query := r.URL.Query()
+	var params database.ListAuditEventsParams
+
+	for name, id := range map[string]*uuid.NullUUID{
+		"actor_id": &params.ActorID,
+		"target_user_id": &params.TargetUserID,
+		"impersonator_id": &params.ImpersonatorID,
+	} {
+		if s := query.Get(name); s != "" {
+			parsed, err := uuid.Parse(s)
+			if err != nil {
+				respondWithError(w, http.StatusBadRequest, "Invalid "+name, err)
+				return
+			}
+			*id = uuid.NullUUID{UUID: parsed, Valid: true}
+		}
+	}
+
+	if action := query.Get("action"); action != "" {
+		params.Action = sql.NullString{String: action, Valid: true}
+	}
+
+	since, err := parseAuditTime(query.Get("since"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "since must be an RFC 3339 time", err)
+		return
+	}
+	params.Since = since
+
+	until, limit, ok := auditPage(w, r)
+	if !ok {
+		return
+	}
+	params.Until = until
+	params.MaxResults = limit
+
+	rows, err := cfg.db.ListAuditEvents(r.Context(), params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get audit events", err)
+		return
+	}
+
+	events := make([]AuditEvent, 0, len(rows))
+	for _, row := range rows {
+		events = append(events, auditEventFromDB(row))
+	}
+
+	respondWithJSON(w, http.StatusOK, events)
+}
+
+// handlerUsersAuditEvents lists the events the caller did or that were done
+// to their account. For events someone else did, like an admin, including
+// while impersonating them, the other person's ID, IP address and user agent
+// are left out.
+func (cfg *apiConfig) handlerUsersAuditEvents(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
+	until, limit, ok := auditPage(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := cfg.db.ListAuditEventsForUser(r.Context(), database.ListAuditEventsForUserParams{
+		UserID: claims.UserID,
+		Until: until,
+		MaxResults: limit,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get audit events", err)
+		return
+	}
+
+	events := make([]AuditEvent, 0, len(rows))
+	for _, row := range rows {
+		event := auditEventFromDB(row)
+		if row.ActorID.Valid && row.ActorID.UUID != claims.UserID {
+			event.ActorID = nil
+			event.IPAddress = ""
+			event.UserAgent = ""
+		}
+		if row.ImpersonatorID.Valid {
+			event.ImpersonatorID = nil
+			event.IPAddress = ""
+			event.UserAgent = ""
+		}
+		events = append(events, event)
+	}
+
+	respondWithJSON(w, http.StatusOK, events)
+}
+
+// auditPage reads the until and limit query parameters shared by the audit
+// event listings.
+func auditPage(w http.ResponseWriter, r *http.Request) (sql.NullTime, int32, bool) {
+	until, err := parseAuditTime(r.URL.Query().Get("until"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "until must be an RFC 3339 time", err)
+		return sql.NullTime{}, 0, false
+	}
+
+	limit := auditEventsDefaultLimit
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > auditEventsMaxLimit {
+			respondWithError(w, http.StatusBadRequest, "limit must be between 1 and 200", err)
+			return sql.NullTime{}, 0, false
+		}
+		limit = n
+	}
+
+	return until, int32(limit), true
+}
+
+func parseAuditTime(s string) (sql.NullTime, error) {
+	if s == "" {
+		return sql.NullTime{}, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return sql.NullTime{}, err
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}, nil
+}
+
+func auditEventFromDB(row database.AuditEvent) AuditEvent {
+	event := AuditEvent{
+		ID: row.ID,
+		CreatedAt: row.CreatedAt,
+		Action: row.Action,
+		IPAddress: row.IpAddress,
+		UserAgent: row.UserAgent,
+		Details: row.Details,
+		Diff: row.Diff,
+		Impersonated: row.ImpersonatorID.Valid,
+	}
+	if row.ActorID.Valid {
+		event.ActorID = &row.ActorID.UUID
+	}
+	if row.TargetUserID.Valid {
+		event.TargetUserID = &row.TargetUserID.UUID
+	}
+	if row.ImpersonatorID.Valid {
+		event.ImpersonatorID = &row.ImpersonatorID.UUID
+	}
+	return event
+}
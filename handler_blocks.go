@@ -0,0 +1,95 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+	"github.com/airlangga-hub/chirpy-go/internal/auth"
+	"github.com/airlangga-hub/chirpy-go/internal/database"
+	"github.com/google/uuid"
+)
+
+type Block struct {
+	UserID uuid.UUID `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (cfg *apiConfig) handlerBlocksRetrieve(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
+	dbBlocks, err := cfg.db.GetBlocks(r.Context(), claims.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get blocked users", err)
+		return
+	}
+
+	blocks := make([]Block, 0, len(dbBlocks))
+	for _, dbBlock := range dbBlocks {
+		blocks = append(blocks, Block{
+			UserID: dbBlock.BlockedID,
+			CreatedAt: dbBlock.CreatedAt,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, blocks)
+}
+
+// handlerBlockCreate blocks a user. Nobody can start a conversation with both
+// of you in it, conversations you already share stop accepting messages, and
+// neither of you follows the other any more.
+func (cfg *apiConfig) handlerBlockCreate(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
+	blockedID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+
+	if blockedID == claims.UserID {
+		respondWithError(w, http.StatusBadRequest, "You can't block yourself", nil)
+		return
+	}
+
+	if _, err := cfg.db.GetUser(r.Context(), blockedID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "User not found", err)
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		}
+		return
+	}
+
+	if err := cfg.db.BlockUser(r.Context(), database.BlockUserParams{
+		BlockerID: claims.UserID,
+		BlockedID: blockedID,
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't block user", err)
+		return
+	}
+
+	if err := cfg.db.DeleteFollowsBetween(r.Context(), database.DeleteFollowsBetweenParams{
+		UserID: claims.UserID,
+		OtherUserID: blockedID,
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't remove follows", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerBlockDelete(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
+	blockedID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+
+	if err := cfg.db.UnblockUser(r.Context(), database.UnblockUserParams{
+		BlockerID: claims.UserID,
+		BlockedID: blockedID,
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't unblock user", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
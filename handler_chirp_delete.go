@@ -7,7 +7,7 @@ import (
 	"github.com/google/uuid"
 )
 
-func (cfg *apiConfig) handlerChirpDelete(w http.ResponseWriter, r *http.Request) {
+func (cfg *apiConfig) handlerChirpDelete(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
 	chirpIDString := r.PathValue("chirpID")
 	chirpID, err := uuid.Parse(chirpIDString)
 	if err != nil {
@@ -15,17 +15,7 @@ func (cfg *apiConfig) handlerChirpDelete(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	accessToken, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find access token", err)
-		return
-	}
-
-	userID, err := auth.ValidateJWT(accessToken, cfg.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusForbidden, "Couldn't validate access token", err)
-		return
-	}
+	userID := claims.UserID
 
 	dbChirp, err := cfg.db.GetChirp(r.Context(), chirpID)
 	if err != nil {
@@ -46,5 +36,23 @@ func (cfg *apiConfig) handlerChirpDelete(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	chirp := Chirp{
+		dbChirp.ID,
+		dbChirp.CreatedAt,
+		dbChirp.UpdatedAt,
+		dbChirp.Body,
+		dbChirp.UserID,
+	}
+
+	cfg.publishChirpEvent(r.Context(), eventChirpDeleted, chirp)
+
+	cfg.audit(r, auditEvent{
+		Action: auditChirpDelete,
+		ActorID: userID,
+		TargetID: userID,
+		Details: map[string]any{"chirp_id": chirpID},
+		Diff: auditDiff(chirp, nil),
+	})
+
 	w.WriteHeader(http.StatusNoContent)
 }
\ No newline at end of file
@@ -19,20 +19,14 @@ type Chirp struct {
 	UserID    uuid.UUID `json:"user_id"`
 }
 
-func (cfg *apiConfig) handlerChirpsCreate(w http.ResponseWriter, r *http.Request) {
+func (cfg *apiConfig) handlerChirpsCreate(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
 	type parameters struct {
 		Body string `json:"body"`
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
-		return
-	}
+	userID := claims.UserID
 
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+	if !cfg.requireVerifiedEmail(w, r, userID) {
 		return
 	}
 
@@ -59,13 +53,17 @@ func (cfg *apiConfig) handlerChirpsCreate(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	respondWithJSON(w, http.StatusCreated, Chirp{
+	created := Chirp{
 		chirp.ID,
 		chirp.CreatedAt,
 		chirp.UpdatedAt,
 		chirp.Body,
 		chirp.UserID,
-	})
+	}
+
+	cfg.publishChirpEvent(r.Context(), eventChirpCreated, created)
+
+	respondWithJSON(w, http.StatusCreated, created)
 }
 
 func validateChirp(body string) (string, error) {
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+	"github.com/airlangga-hub/chirpy-go/internal/auth"
+	"github.com/airlangga-hub/chirpy-go/internal/database"
+	"github.com/airlangga-hub/chirpy-go/internal/social"
+	"github.com/google/uuid"
+)
+
+const maxConversationMembers = 10
+
+type ConversationMember struct {
+	UserID     uuid.UUID  `json:"user_id"`
+	JoinedAt   time.Time  `json:"joined_at"`
+	LastReadAt *time.Time `json:"last_read_at"`
+}
+
+type Conversation struct {
+	ID          uuid.UUID            `json:"id"`
+	CreatedAt   time.Time            `json:"created_at"`
+	UpdatedAt   time.Time            `json:"updated_at"`
+	Members     []ConversationMember `json:"members"`
+	LastMessage *Message             `json:"last_message"`
+	UnreadCount int64                `json:"unread_count"`
+}
+
+func (cfg *apiConfig) handlerConversationsCreate(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
+	type parameters struct {
+		UserIDs []uuid.UUID `json:"user_ids"`
+	}
+
+	userID := claims.UserID
+
+	var params parameters
+
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
+		return
+	}
+
+	memberIDs := []uuid.UUID{userID}
+	seen := map[uuid.UUID]struct{}{userID: {}}
+	for _, id := range params.UserIDs {
+		if _, exist := seen[id]; exist {
+			continue
+		}
+		seen[id] = struct{}{}
+		memberIDs = append(memberIDs, id)
+	}
+
+	if len(memberIDs) < 2 {
+		respondWithError(w, http.StatusBadRequest, "A conversation needs at least one other user", nil)
+		return
+	}
+	if len(memberIDs) > maxConversationMembers {
+		respondWithError(w, http.StatusBadRequest, "Too many conversation members", nil)
+		return
+	}
+
+	for _, id := range memberIDs[1:] {
+		if _, err := cfg.db.GetUser(r.Context(), id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				respondWithError(w, http.StatusNotFound, "User not found", err)
+			} else {
+				respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+			}
+			return
+		}
+	}
+
+	blocked, err := cfg.db.HasBlockBetween(r.Context(), memberIDs)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check blocks", err)
+		return
+	}
+	if blocked {
+		respondWithError(w, http.StatusForbidden, "A member has blocked another member", nil)
+		return
+	}
+
+	if !cfg.requireDMAccepted(w, r, userID, memberIDs[1:]) {
+		return
+	}
+
+	if len(memberIDs) == 2 {
+		if cfg.respondWithDirectConversation(w, r, userID, memberIDs[1]) {
+			return
+		}
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create conversation", err)
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := cfg.db.WithTx(tx)
+
+	dbConversation, err := qtx.CreateConversation(r.Context())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create conversation", err)
+		return
+	}
+
+	for _, id := range memberIDs {
+		if err := qtx.AddConversationMember(r.Context(), database.AddConversationMemberParams{
+			ConversationID: dbConversation.ID,
+			UserID: id,
+		}); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't add conversation member", err)
+			return
+		}
+	}
+
+	if len(memberIDs) == 2 {
+		// The pair is unique, so if another request created this conversation
+		// since the check above, answer with that one instead.
+		_, err := qtx.CreateDirectConversation(r.Context(), database.CreateDirectConversationParams{
+			UserID: userID,
+			OtherUserID: memberIDs[1],
+			ConversationID: dbConversation.ID,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			tx.Rollback()
+			if !cfg.respondWithDirectConversation(w, r, userID, memberIDs[1]) {
+				respondWithError(w, http.StatusInternalServerError, "Couldn't get conversation", nil)
+			}
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't create conversation", err)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create conversation", err)
+		return
+	}
+
+	conversation, err := cfg.getConversation(r, dbConversation)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get conversation", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, conversation)
+}
+
+func (cfg *apiConfig) handlerConversationsRetrieve(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
+	userID := claims.UserID
+
+	rows, err := cfg.db.GetConversationsForUser(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get conversations", err)
+		return
+	}
+
+	conversations := []Conversation{}
+
+	for _, row := range rows {
+		members, err := cfg.getConversationMembers(r, row.ID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get conversation members", err)
+			return
+		}
+
+		conversation := Conversation{
+			ID: row.ID,
+			CreatedAt: row.CreatedAt,
+			UpdatedAt: row.UpdatedAt,
+			Members: members,
+			UnreadCount: row.UnreadCount,
+		}
+
+		if row.LastMessageID.Valid {
+			conversation.LastMessage = &Message{
+				ID: row.LastMessageID.UUID,
+				CreatedAt: row.LastMessageCreatedAt.Time,
+				ConversationID: row.ID,
+				SenderID: row.LastMessageSenderID.UUID,
+				Body: row.LastMessageBody.String,
+			}
+		}
+
+		conversations = append(conversations, conversation)
+	}
+
+	respondWithJSON(w, http.StatusOK, conversations)
+}
+
+func (cfg *apiConfig) handlerConversationRead(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
+	conversationID, err := uuid.Parse(r.PathValue("conversationID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid conversation ID", err)
+		return
+	}
+
+	userID := claims.UserID
+
+	dbMember, err := cfg.db.MarkConversationRead(r.Context(), database.MarkConversationReadParams{
+		ConversationID: conversationID,
+		UserID: userID,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "Conversation not found", err)
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't mark conversation read", err)
+		}
+		return
+	}
+
+	member := conversationMemberFromDB(dbMember)
+
+	cfg.publishConversationEvent(conversationID, eventConversationRead, member)
+
+	respondWithJSON(w, http.StatusOK, member)
+}
+
+// requireDMAccepted refuses with 403 when any of recipientIDs only takes
+// direct messages from people they follow and doesn't follow senderID.
+func (cfg *apiConfig) requireDMAccepted(w http.ResponseWriter, r *http.Request, senderID uuid.UUID, recipientIDs []uuid.UUID) bool {
+	recipients, err := cfg.db.GetDMRecipients(r.Context(), database.GetDMRecipientsParams{
+		SenderID: senderID,
+		RecipientIds: recipientIDs,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check message settings", err)
+		return false
+	}
+
+	for _, recipient := range recipients {
+		if !social.AcceptsDM(recipient.DmPolicy, recipient.FollowsSender) {
+			respondWithError(w, http.StatusForbidden, "A member only accepts messages from people they follow", nil)
+			return false
+		}
+	}
+	return true
+}
+
+// respondWithDirectConversation responds with the one-to-one conversation
+// between the two users and reports whether there was one. It also reports
+// true when it has already responded with an error.
+func (cfg *apiConfig) respondWithDirectConversation(w http.ResponseWriter, r *http.Request, userID, otherUserID uuid.UUID) bool {
+	existing, err := cfg.db.GetDirectConversation(r.Context(), database.GetDirectConversationParams{
+		UserID: userID,
+		OtherUserID: otherUserID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return false
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get conversation", err)
+		return true
+	}
+
+	conversation, err := cfg.getConversation(r, existing)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get conversation", err)
+		return true
+	}
+	respondWithJSON(w, http.StatusOK, conversation)
+	return true
+}
+
+func (cfg *apiConfig) getConversation(r *http.Request, dbConversation database.Conversation) (Conversation, error) {
+	members, err := cfg.getConversationMembers(r, dbConversation.ID)
+	if err != nil {
+		return Conversation{}, err
+	}
+
+	return Conversation{
+		ID: dbConversation.ID,
+		CreatedAt: dbConversation.CreatedAt,
+		UpdatedAt: dbConversation.UpdatedAt,
+		Members: members,
+	}, nil
+}
+
+func (cfg *apiConfig) getConversationMembers(r *http.Request, conversationID uuid.UUID) ([]ConversationMember, error) {
+	dbMembers, err := cfg.db.GetConversationMembers(r.Context(), conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	members := make([]ConversationMember, 0, len(dbMembers))
+	for _, dbMember := range dbMembers {
+		members = append(members, conversationMemberFromDB(dbMember))
+	}
+
+	return members, nil
+}
+
+func conversationMemberFromDB(dbMember database.ConversationMember) ConversationMember {
+	member := ConversationMember{
+		UserID: dbMember.UserID,
+		JoinedAt: dbMember.JoinedAt,
+	}
+	if dbMember.LastReadAt.Valid {
+		member.LastReadAt = &dbMember.LastReadAt.Time
+	}
+	return member
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"github.com/airlangga-hub/chirpy-go/internal/auth"
+	"github.com/airlangga-hub/chirpy-go/internal/database"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handlerFollowCreate(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
+	followedID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+
+	if followedID == claims.UserID {
+		respondWithError(w, http.StatusBadRequest, "You can't follow yourself", nil)
+		return
+	}
+
+	if _, err := cfg.db.GetUser(r.Context(), followedID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "User not found", err)
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		}
+		return
+	}
+
+	blocked, err := cfg.db.HasBlockBetween(r.Context(), []uuid.UUID{claims.UserID, followedID})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check blocks", err)
+		return
+	}
+	if blocked {
+		respondWithError(w, http.StatusForbidden, "You can't follow this user", nil)
+		return
+	}
+
+	if err := cfg.db.FollowUser(r.Context(), database.FollowUserParams{
+		FollowerID: claims.UserID,
+		FollowedID: followedID,
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't follow user", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerFollowDelete(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
+	followedID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+
+	if err := cfg.db.UnfollowUser(r.Context(), database.UnfollowUserParams{
+		FollowerID: claims.UserID,
+		FollowedID: followedID,
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't unfollow user", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,12 @@
+package main
+
+import (
+	"net/http"
+)
+
+// handlerJWKS publishes the public keys access tokens are signed with, so
+// other services can verify them without sharing a secret.
+func (cfg *apiConfig) handlerJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respondWithJSON(w, http.StatusOK, cfg.jwtKeys.JWKS())
+}
@@ -1,11 +1,18 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
 	"net/http"
 	"encoding/json"
+	"strings"
+	"time"
 	"github.com/airlangga-hub/chirpy-go/internal/auth"
 	"github.com/airlangga-hub/chirpy-go/internal/database"
-	"time"
 )
 
 func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
@@ -14,12 +21,6 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		Password string `json:"password"`
 	}
 
-	type response struct {
-		User
-		Token string `json:"token"`
-		RefreshToken string `json:"refresh_token"`
-	}
-
 	var params parameters
 
 	decoder := json.NewDecoder(r.Body)
@@ -28,44 +29,215 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := cfg.db.GetUserByEmail(r.Context(), params.Email)
+	now := time.Now().UTC()
+	throttles := loginThrottles(params.Email, clientIP(r))
+
+	retryAfter, _, err := cfg.reserveLoginAttempt(r.Context(), throttles, now)
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Invalid user email", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check login attempts", err)
+		return
+	}
+	if retryAfter > 0 {
+		cfg.audit(r, auditEvent{
+			Action: auditLoginThrottled,
+			Details: map[string]any{"email": params.Email},
+		})
+		w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(retryAfter.Seconds()))))
+		respondWithError(w, http.StatusTooManyRequests, "Too many failed login attempts, try again later", nil)
 		return
 	}
 
-	match, err := auth.CheckPasswordHash(params.Password, user.HashedPassword)
-	if !match || err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Unauthrozied user", err)
+	// Unknown emails and wrong passwords get the same answer after the same
+	// amount of work, so neither reveals which accounts exist.
+	user, err := cfg.db.GetUserByEmail(r.Context(), params.Email)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
 		return
 	}
 
-	accessToken, err := auth.MakeJWT(user.ID, cfg.jwtSecret, time.Hour)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't create access JWT", err)
+	match := false
+	if err == nil {
+		match, err = auth.CheckPasswordHash(params.Password, user.HashedPassword)
+	} else {
+		auth.CheckPasswordDummy(params.Password)
+	}
+
+	if !match {
+		cfg.audit(r, auditEvent{
+			Action: auditLoginFailed,
+			TargetID: user.ID,
+			Details: map[string]any{"email": params.Email},
+		})
+		respondWithError(w, http.StatusUnauthorized, "Incorrect email or password", err)
 		return
 	}
 
-	refreshToken := auth.MakeRefreshToken()
+	if auth.PasswordNeedsRehash(user.HashedPassword) {
+		cfg.rehashPassword(r.Context(), user, params.Password)
+	}
+
+	// The attempt reserved against each counter is given back, but only the
+	// account's count is cleared: one good login from an address shouldn't
+	// excuse everything else tried from it. With two-factor on it waits for
+	// handlerLoginMFA, or a password alone would reset the count.
+	cfg.releaseLoginAttempt(r.Context(), throttles[1].key)
+	if user.TotpEnabledAt.Valid {
+		cfg.releaseLoginAttempt(r.Context(), throttles[0].key)
+	} else if err := cfg.db.ClearLoginFailures(r.Context(), throttles[0].key); err != nil {
+		log.Printf("Error clearing login failures: %s", err)
+	}
 
-	_, err = cfg.db.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
-		Token: refreshToken,
-		UserID: user.ID,
-		ExpiresAt: time.Now().UTC().Add(time.Hour * 24 * 60),
+	cfg.audit(r, auditEvent{
+		Action: auditLogin,
+		ActorID: user.ID,
+		TargetID: user.ID,
+		Details: map[string]any{"mfa_required": user.TotpEnabledAt.Valid},
 	})
+
+	cfg.respondWithLogin(w, r, user)
+}
+
+// rehashPassword upgrades user's hash to the current argon2id parameters
+// while the password is at hand. Failing only delays the upgrade to the next
+// login, so errors are logged rather than failing the login.
+func (cfg *apiConfig) rehashPassword(ctx context.Context, user database.User, password string) {
+	hashedPassword, err := auth.HashPassword(password)
+	if err != nil {
+		log.Printf("Error rehashing password for user %s: %s", user.ID, err)
+		return
+	}
+
+	// Matching the old hash keeps a password changed in the meantime.
+	if err := cfg.db.RehashUserPassword(ctx, database.RehashUserPasswordParams{
+		NewHash: hashedPassword,
+		ID: user.ID,
+		OldHash: user.HashedPassword,
+	}); err != nil {
+		log.Printf("Error rehashing password for user %s: %s", user.ID, err)
+	}
+}
+
+type loginThrottle struct {
+	key string
+	throttle auth.LoginThrottle
+}
+
+// loginThrottles lists the counters a login attempt counts against. The
+// account's comes first. Emails are counted whether or not an account has
+// them, so a lockout doesn't reveal that one does.
+func loginThrottles(email, ip string) []loginThrottle {
+	return []loginThrottle{
+		{key: "email:" + strings.ToLower(strings.TrimSpace(email)), throttle: auth.AccountThrottle},
+		{key: "ip:" + ip, throttle: auth.IPThrottle},
+	}
+}
+
+// reserveLoginAttempt counts an attempt against every one of throttles as a
+// failure before the credentials are even checked, and gives it back with
+// releaseLoginAttempt if they turn out right. Each counter is locked while it
+// is checked and bumped, so a burst of parallel attempts can't all read the
+// same count. If any throttle refuses, nothing is counted; it returns the
+// longest wait and the key of the first throttle that refused.
+func (cfg *apiConfig) reserveLoginAttempt(ctx context.Context, throttles []loginThrottle, now time.Time) (time.Duration, string, error) {
+	if err := cfg.db.DeleteStaleLoginFailures(ctx, now.Add(-auth.AccountThrottle.ResetAfter)); err != nil {
+		log.Printf("Error deleting stale login failures: %s", err)
+	}
+
+	tx, err := cfg.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, "", err
+	}
+	defer tx.Rollback()
+
+	qtx := cfg.db.WithTx(tx)
+
+	var retryAfter time.Duration
+	var refusedBy string
+
+	for _, t := range throttles {
+		if err := qtx.EnsureLoginFailure(ctx, database.EnsureLoginFailureParams{
+			Key: t.key,
+			CreatedAt: now,
+		}); err != nil {
+			return 0, "", err
+		}
+
+		failure, err := qtx.LockLoginFailure(ctx, t.key)
+		if err != nil {
+			return 0, "", err
+		}
+
+		wait := t.throttle.RetryAfter(int(failure.Failures), failure.LastFailureAt, now)
+		if wait > 0 && refusedBy == "" {
+			refusedBy = t.key
+		}
+		retryAfter = max(retryAfter, wait)
+	}
+
+	if retryAfter > 0 {
+		return retryAfter, refusedBy, nil
+	}
+
+	for _, t := range throttles {
+		if _, err := qtx.RecordLoginFailure(ctx, database.RecordLoginFailureParams{
+			Key: t.key,
+			FailedAt: now,
+			ResetBefore: now.Add(-t.throttle.ResetAfter),
+		}); err != nil {
+			return 0, "", err
+		}
+	}
+
+	return 0, "", tx.Commit()
+}
+
+// releaseLoginAttempt takes back an attempt reserveLoginAttempt counted
+// against each of keys.
+func (cfg *apiConfig) releaseLoginAttempt(ctx context.Context, keys ...string) {
+	for _, key := range keys {
+		if err := cfg.db.ReleaseLoginFailure(ctx, key); err != nil {
+			log.Printf("Error releasing login attempt for %s: %s", key, err)
+		}
+	}
+}
+
+// respondWithLogin finishes signing user in, however they proved who they
+// are: with an access and refresh token pair, or an MFA token when two-factor
+// authentication is on.
+func (cfg *apiConfig) respondWithLogin(w http.ResponseWriter, r *http.Request, user database.User) {
+	type response struct {
+		User
+		Token string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	if user.TotpEnabledAt.Valid {
+		type mfaResponse struct {
+			MFARequired bool `json:"mfa_required"`
+			MFAToken string `json:"mfa_token"`
+		}
+
+		mfaToken, err := auth.MakeMFAToken(user.ID, cfg.jwtKeys, mfaTokenTTL)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't create MFA token", err)
+			return
+		}
+
+		respondWithJSON(w, http.StatusOK, mfaResponse{
+			MFARequired: true,
+			MFAToken: mfaToken,
+		})
+		return
+	}
+
+	accessToken, refreshToken, err := cfg.issueTokens(r, user.ID)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't save refresh token", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create session", err)
 		return
 	}
 
 	respondWithJSON(w, http.StatusOK, response{
-		User: User{
-			ID: user.ID,
-			CreatedAt: user.CreatedAt,
-			UpdatedAt: user.UpdatedAt,
-			Email: user.Email,
-			IsChirpyRed: user.IsChirpyRed,
-		},
+		User: cfg.userFromDB(user),
 		Token: accessToken,
 		RefreshToken: refreshToken,
 	})
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"github.com/airlangga-hub/chirpy-go/internal/auth"
+	"github.com/airlangga-hub/chirpy-go/internal/database"
+	"github.com/airlangga-hub/chirpy-go/internal/mailer"
+)
+
+const (
+	magicLinkTTL = 15 * time.Minute
+	magicLinkCookie = "chirpy_magic_link"
+	magicLinkCooldown = time.Minute
+	magicLinkHourlyLimit = 5
+	magicLinkMailTimeout = 30 * time.Second
+)
+
+// handlerMagicLinkRequest emails a one-time login link. The link only works
+// in the browser that asked for it: that browser gets a random key in a
+// cookie, and the token is stored with the key's hash.
+func (cfg *apiConfig) handlerMagicLinkRequest(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Email string `json:"email"`
+	}
+
+	var params parameters
+
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
+		return
+	}
+
+	// Keep an existing key so that every link this browser asked for still
+	// works, not just the latest.
+	browserKey := auth.MakeRefreshToken()
+	if cookie, err := r.Cookie(magicLinkCookie); err == nil && len(cookie.Value) == len(browserKey) {
+		browserKey = cookie.Value
+	}
+	http.SetCookie(w, cfg.magicLinkCookie(browserKey, int(magicLinkTTL.Seconds())))
+
+	// Like a password reset, the lookup and email happen after responding so
+	// neither the status nor the timing reveals whether the account exists.
+	go func(email, browserHash string) {
+		ctx, cancel := context.WithTimeout(context.Background(), magicLinkMailTimeout)
+		defer cancel()
+
+		if err := cfg.sendMagicLinkEmail(ctx, email, browserHash); err != nil {
+			log.Printf("Error sending magic link email: %s", err)
+		}
+	}(params.Email, auth.HashToken(browserKey))
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (cfg *apiConfig) sendMagicLinkEmail(ctx context.Context, email, browserHash string) error {
+	user, err := cfg.db.GetUserByEmail(ctx, email)
+	if err != nil {
+		return nil
+	}
+
+	now := time.Now().UTC()
+
+	recent, err := cfg.db.CountMagicLinkTokensSince(ctx, database.CountMagicLinkTokensSinceParams{
+		UserID: user.ID,
+		CreatedAt: now.Add(-magicLinkCooldown),
+	})
+	if err != nil {
+		return err
+	}
+	hourly, err := cfg.db.CountMagicLinkTokensSince(ctx, database.CountMagicLinkTokensSinceParams{
+		UserID: user.ID,
+		CreatedAt: now.Add(-time.Hour),
+	})
+	if err != nil {
+		return err
+	}
+	if recent > 0 || hourly >= magicLinkHourlyLimit {
+		return nil
+	}
+
+	token := auth.MakeRefreshToken()
+
+	if err := cfg.db.CreateMagicLinkToken(ctx, database.CreateMagicLinkTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID: user.ID,
+		BrowserHash: browserHash,
+		ExpiresAt: now.Add(magicLinkTTL),
+	}); err != nil {
+		return err
+	}
+
+	return cfg.mailer.Send(ctx, mailer.Message{
+		To: user.Email,
+		Subject: "Your Chirpy login link",
+		Body: fmt.Sprintf(
+			"Open the link below within 15 minutes, in the same browser you asked from, to log in to Chirpy:\n\n%s/api/login/magic/redeem?token=%s\n\nThe link works once. If you didn't ask for it, you can ignore this email.\n",
+			cfg.publicURL,
+			token,
+		),
+	})
+}
+
+// handlerMagicLinkRedeem logs in with a token from a magic link. It answers
+// like handlerLogin, so two-factor authentication still applies.
+func (cfg *apiConfig) handlerMagicLinkRedeem(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token string `json:"token"`
+	}
+
+	var params parameters
+
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
+		return
+	}
+
+	cfg.redeemMagicLink(w, r, params.Token)
+}
+
+// handlerMagicLinkRedeemFromEmail is where the emailed link points: the same
+// redemption, with the token in the query string.
+func (cfg *apiConfig) handlerMagicLinkRedeemFromEmail(w http.ResponseWriter, r *http.Request) {
+	cfg.redeemMagicLink(w, r, r.URL.Query().Get("token"))
+}
+
+func (cfg *apiConfig) redeemMagicLink(w http.ResponseWriter, r *http.Request, token string) {
+	cookie, err := r.Cookie(magicLinkCookie)
+	if err != nil || strings.TrimSpace(token) == "" {
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired login link", err)
+		return
+	}
+
+	// A link opened in another browser doesn't match and isn't used up, so
+	// the person who asked for it can still log in.
+	magicLink, err := cfg.db.RedeemMagicLinkToken(r.Context(), database.RedeemMagicLinkTokenParams{
+		TokenHash: auth.HashToken(token),
+		BrowserHash: auth.HashToken(cookie.Value),
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusBadRequest, "Invalid or expired login link", err)
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't redeem login link", err)
+		}
+		return
+	}
+
+	user, err := cfg.db.GetUser(r.Context(), magicLink.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+
+	cfg.respondWithLogin(w, r, user)
+}
+
+// The cookie is Lax rather than Strict because opening the emailed link is a
+// navigation from the mail client, and Strict cookies aren't sent on those.
+func (cfg *apiConfig) magicLinkCookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name: magicLinkCookie,
+		Value: value,
+		Path: "/api/login/magic",
+		MaxAge: maxAge,
+		HttpOnly: true,
+		Secure: strings.HasPrefix(cfg.publicURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	}
+}
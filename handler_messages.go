@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+	"github.com/airlangga-hub/chirpy-go/internal/auth"
+	"github.com/airlangga-hub/chirpy-go/internal/database"
+	"github.com/google/uuid"
+)
+
+type Message struct {
+	ID             uuid.UUID `json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	ConversationID uuid.UUID `json:"conversation_id"`
+	SenderID       uuid.UUID `json:"sender_id"`
+	Body           string    `json:"body"`
+}
+
+func (cfg *apiConfig) handlerMessagesCreate(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
+	type parameters struct {
+		Body string `json:"body"`
+	}
+
+	conversationID, err := uuid.Parse(r.PathValue("conversationID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid conversation ID", err)
+		return
+	}
+
+	userID := claims.UserID
+
+	if !cfg.requireConversationMember(w, r, conversationID, userID) {
+		return
+	}
+
+	if !cfg.requireVerifiedEmail(w, r, userID) {
+		return
+	}
+
+	blocked, err := cfg.db.HasConversationBlock(r.Context(), conversationID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check blocks", err)
+		return
+	}
+	if blocked {
+		respondWithError(w, http.StatusForbidden, "A member has blocked another member", nil)
+		return
+	}
+
+	members, err := cfg.db.GetConversationMembers(r.Context(), conversationID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get conversation members", err)
+		return
+	}
+	memberIDs := make([]uuid.UUID, 0, len(members))
+	for _, member := range members {
+		memberIDs = append(memberIDs, member.UserID)
+	}
+	if !cfg.requireDMAccepted(w, r, userID, memberIDs) {
+		return
+	}
+
+	var params parameters
+
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
+		return
+	}
+
+	cleaned, err := validateChirp(params.Body)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	dbMessage, err := cfg.db.CreateMessage(r.Context(), database.CreateMessageParams{
+		ConversationID: conversationID,
+		SenderID: userID,
+		Body: cleaned,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't send message", err)
+		return
+	}
+
+	if err := cfg.db.TouchConversation(r.Context(), conversationID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update conversation", err)
+		return
+	}
+
+	message := Message{
+		ID: dbMessage.ID,
+		CreatedAt: dbMessage.CreatedAt,
+		ConversationID: dbMessage.ConversationID,
+		SenderID: dbMessage.SenderID,
+		Body: dbMessage.Body,
+	}
+
+	cfg.publishConversationEvent(conversationID, eventMessageCreated, message)
+
+	respondWithJSON(w, http.StatusCreated, message)
+}
+
+func (cfg *apiConfig) handlerMessagesRetrieve(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
+	conversationID, err := uuid.Parse(r.PathValue("conversationID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid conversation ID", err)
+		return
+	}
+
+	userID := claims.UserID
+
+	if !cfg.requireConversationMember(w, r, conversationID, userID) {
+		return
+	}
+
+	dbMessages, err := cfg.db.GetMessages(r.Context(), conversationID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get messages", err)
+		return
+	}
+
+	messages := []Message{}
+
+	for _, dbMessage := range dbMessages {
+		messages = append(messages, Message{
+			ID: dbMessage.ID,
+			CreatedAt: dbMessage.CreatedAt,
+			ConversationID: dbMessage.ConversationID,
+			SenderID: dbMessage.SenderID,
+			Body: dbMessage.Body,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, messages)
+}
+
+// requireConversationMember responds with 404 rather than 403 for non-members
+// so conversation IDs can't be probed.
+func (cfg *apiConfig) requireConversationMember(w http.ResponseWriter, r *http.Request, conversationID, userID uuid.UUID) bool {
+	isMember, err := cfg.db.IsConversationMember(r.Context(), database.IsConversationMemberParams{
+		ConversationID: conversationID,
+		UserID: userID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get conversation", err)
+		return false
+	}
+	if !isMember {
+		respondWithError(w, http.StatusNotFound, "Conversation not found", nil)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"time"
+	"github.com/airlangga-hub/chirpy-go/internal/auth"
+	"github.com/airlangga-hub/chirpy-go/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	mfaTokenTTL = 5 * time.Minute
+	totpIssuer = "Chirpy"
+	recoveryCodeCount = 10
+)
+
+var errInvalidSecondFactor = errors.New("Invalid two-factor code")
+
+func (cfg *apiConfig) handlerTOTPEnroll(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
+	type response struct {
+		Secret string `json:"secret"`
+		URI string `json:"uri"`
+	}
+
+	userID := claims.UserID
+
+	user, err := cfg.db.GetUser(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get user", err)
+		return
+	}
+
+	if user.TotpEnabledAt.Valid {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled", nil)
+		return
+	}
+
+	secret := auth.MakeTOTPSecret()
+
+	if err := cfg.db.SetUserTOTPSecret(r.Context(), database.SetUserTOTPSecretParams{
+		TotpSecret: sql.NullString{String: secret, Valid: true},
+		ID: userID,
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't start enrollment", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		Secret: secret,
+		URI: auth.TOTPURI(secret, user.Email, totpIssuer),
+	})
+}
+
+// handlerTOTPConfirm turns 2FA on once the user proves their authenticator
+// produces valid codes, and hands out the recovery codes. They are only ever
+// shown here.
+func (cfg *apiConfig) handlerTOTPConfirm(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
+	type parameters struct {
+		Code string `json:"code"`
+	}
+
+	type response struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	userID := claims.UserID
+
+	var params parameters
+
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
+		return
+	}
+
+	user, err := cfg.db.GetUser(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get user", err)
+		return
+	}
+
+	if user.TotpEnabledAt.Valid {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled", nil)
+		return
+	}
+	if !user.TotpSecret.Valid {
+		respondWithError(w, http.StatusBadRequest, "Two-factor enrollment hasn't been started", nil)
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(user.TotpSecret.String, params.Code, time.Now())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, errInvalidSecondFactor.Error(), nil)
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't enable two-factor authentication", err)
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := cfg.db.WithTx(tx)
+
+	if err := qtx.EnableUserTOTP(r.Context(), database.EnableUserTOTPParams{
+		TotpLastStep: step,
+		ID: userID,
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't enable two-factor authentication", err)
+		return
+	}
+
+	if err := qtx.DeleteRecoveryCodes(r.Context(), userID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create recovery codes", err)
+		return
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for range recoveryCodeCount {
+		code := auth.MakeRecoveryCode()
+		if err := qtx.CreateRecoveryCode(r.Context(), database.CreateRecoveryCodeParams{
+			UserID: userID,
+			CodeHash: auth.HashToken(auth.NormalizeRecoveryCode(code)),
+		}); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't create recovery codes", err)
+			return
+		}
+		codes = append(codes, code)
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't enable two-factor authentication", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		RecoveryCodes: codes,
+	})
+}
+
+func (cfg *apiConfig) handlerTOTPDisable(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
+	type parameters struct {
+		Password string `json:"password"`
+		Code string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	userID := claims.UserID
+
+	var params parameters
+
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
+		return
+	}
+
+	user, err := cfg.db.GetUser(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get user", err)
+		return
+	}
+
+	if !user.TotpEnabledAt.Valid {
+		respondWithError(w, http.StatusBadRequest, "Two-factor authentication isn't enabled", nil)
+		return
+	}
+
+	// Wrong passwords and codes here count against the same account throttle
+	// as the login's second factor, so this isn't a way around it.
+	accountThrottle := mfaAccountThrottle(userID)
+
+	retryAfter, _, err := cfg.reserveLoginAttempt(r.Context(), []loginThrottle{accountThrottle}, time.Now().UTC())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check two-factor attempts", err)
+		return
+	}
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(retryAfter.Seconds()))))
+		respondWithError(w, http.StatusTooManyRequests, "Too many incorrect codes, try again later", nil)
+		return
+	}
+
+	match, err := auth.CheckPasswordHash(params.Password, user.HashedPassword)
+	if !match || err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Password is incorrect", err)
+		return
+	}
+
+	if err := cfg.checkSecondFactor(r.Context(), user, params.Code, params.RecoveryCode); err != nil {
+		if errors.Is(err, errInvalidSecondFactor) {
+			respondWithError(w, http.StatusUnauthorized, err.Error(), nil)
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't check two-factor code", err)
+		}
+		return
+	}
+
+	if err := cfg.db.ClearLoginFailures(r.Context(), accountThrottle.key); err != nil {
+		log.Printf("Error clearing login failures: %s", err)
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't disable two-factor authentication", err)
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := cfg.db.WithTx(tx)
+
+	if err := qtx.DisableUserTOTP(r.Context(), userID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't disable two-factor authentication", err)
+		return
+	}
+
+	if err := qtx.DeleteRecoveryCodes(r.Context(), userID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete recovery codes", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't disable two-factor authentication", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerLoginMFA finishes a login that handlerLogin paused for a second
+// factor, and answers exactly like handlerLogin.
+func (cfg *apiConfig) handlerLoginMFA(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		MFAToken string `json:"mfa_token"`
+		Code string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	type response struct {
+		User
+		Token string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	var params parameters
+
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
+		return
+	}
+
+	claims, err := auth.ValidateMFAToken(r.Context(), params.MFAToken, cfg.jwtKeys, cfg.revocations)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate MFA token", err)
+		return
+	}
+
+	user, err := cfg.db.GetUser(r.Context(), claims.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate MFA token", err)
+		return
+	}
+
+	if !user.TotpEnabledAt.Valid {
+		respondWithError(w, http.StatusBadRequest, "Two-factor authentication isn't enabled", nil)
+		return
+	}
+
+	now := time.Now().UTC()
+	accountThrottle, tokenThrottle := mfaThrottles(claims)
+
+	retryAfter, refusedBy, err := cfg.reserveLoginAttempt(r.Context(), []loginThrottle{tokenThrottle, accountThrottle}, now)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check two-factor attempts", err)
+		return
+	}
+	if refusedBy == tokenThrottle.key {
+		respondWithError(w, http.StatusUnauthorized, "Too many incorrect codes, log in again", nil)
+		return
+	}
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(retryAfter.Seconds()))))
+		respondWithError(w, http.StatusTooManyRequests, "Too many incorrect codes, try again later", nil)
+		return
+	}
+
+	if err := cfg.checkSecondFactor(r.Context(), user, params.Code, params.RecoveryCode); err != nil {
+		if errors.Is(err, errInvalidSecondFactor) {
+			respondWithError(w, http.StatusUnauthorized, err.Error(), nil)
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't check two-factor code", err)
+		}
+		return
+	}
+
+	// The login is complete only now, so this is where the password
+	// step's count is cleared too. The MFA token is spent.
+	for _, key := range []string{accountThrottle.key, loginThrottles(user.Email, clientIP(r))[0].key} {
+		if err := cfg.db.ClearLoginFailures(r.Context(), key); err != nil {
+			log.Printf("Error clearing login failures: %s", err)
+		}
+	}
+	if err := cfg.revocations.RevokeToken(r.Context(), claims.ID, claims.ExpiresAt); err != nil {
+		log.Printf("Error revoking used MFA token: %s", err)
+	}
+
+	accessToken, refreshToken, err := cfg.issueTokens(r, user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create session", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		User: cfg.userFromDB(user),
+		Token: accessToken,
+		RefreshToken: refreshToken,
+	})
+}
+
+// mfaThrottles returns the counters a second factor attempt counts against:
+// the account's, which outlives any one MFA token, and the token's own, which
+// burns it after auth.MFATokenMaxFailures wrong codes.
+func mfaThrottles(claims auth.Claims) (loginThrottle, loginThrottle) {
+	return mfaAccountThrottle(claims.UserID),
+		loginThrottle{key: "mfa_token:" + claims.ID, throttle: auth.MFATokenThrottle}
+}
+
+func mfaAccountThrottle(userID uuid.UUID) loginThrottle {
+	return loginThrottle{key: "mfa:" + userID.String(), throttle: auth.MFAThrottle}
+}
+
+// checkSecondFactor accepts either a TOTP code or an unused recovery code.
+// Each TOTP time step and each recovery code only works once.
+func (cfg *apiConfig) checkSecondFactor(ctx context.Context, user database.User, code, recoveryCode string) error {
+	if recoveryCode != "" {
+		used, err := cfg.db.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{
+			UserID: user.ID,
+			CodeHash: auth.HashToken(auth.NormalizeRecoveryCode(recoveryCode)),
+		})
+		if err != nil {
+			return err
+		}
+		if used == 0 {
+			return errInvalidSecondFactor
+		}
+		return nil
+	}
+
+	step, ok := auth.ValidateTOTP(user.TotpSecret.String, code, time.Now())
+	if !ok {
+		return errInvalidSecondFactor
+	}
+
+	used, err := cfg.db.UseTOTPStep(ctx, database.UseTOTPStepParams{
+		TotpLastStep: step,
+		ID: user.ID,
+	})
+	if err != nil {
+		return err
+	}
+	if used == 0 {
+		return errInvalidSecondFactor
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+	"github.com/airlangga-hub/chirpy-go/internal/auth"
+	"github.com/airlangga-hub/chirpy-go/internal/database"
+	"github.com/airlangga-hub/chirpy-go/internal/oauth"
+	"github.com/google/uuid"
+)
+
+const maxRedirectURIs = 10
+
+// OAuthClient is a third-party app a user registered. ClientSecret is only
+// set in the response that creates a confidential client.
+type OAuthClient struct {
+	ID           uuid.UUID `json:"client_id"`
+	CreatedAt    time.Time `json:"created_at"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Confidential bool      `json:"confidential"`
+	ClientSecret string    `json:"client_secret,omitempty"`
+}
+
+func oauthClientFromDB(client database.OauthClient) OAuthClient {
+	return OAuthClient{
+		ID: client.ID,
+		CreatedAt: client.CreatedAt,
+		Name: client.Name,
+		RedirectURIs: client.RedirectUris,
+		Confidential: client.SecretHash.Valid,
+	}
+}
+
+func (cfg *apiConfig) handlerOAuthClientsCreate(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
+	type parameters struct {
+		Name string `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Confidential bool `json:"confidential"`
+	}
+
+	var params parameters
+
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
+		return
+	}
+
+	name := strings.TrimSpace(params.Name)
+	if name == "" || len(name) > maxTokenNameLength {
+		respondWithError(w, http.StatusBadRequest, "Name must be 1-100 characters", nil)
+		return
+	}
+
+	if len(params.RedirectURIs) == 0 || len(params.RedirectURIs) > maxRedirectURIs {
+		respondWithError(w, http.StatusBadRequest, "Clients need 1-10 redirect URIs", nil)
+		return
+	}
+	for _, redirectURI := range params.RedirectURIs {
+		if err := oauth.ValidateRedirectURI(redirectURI); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+	}
+
+	var secret string
+	var secretHash sql.NullString
+	if params.Confidential {
+		secret = auth.MakeRefreshToken()
+		secretHash = sql.NullString{String: auth.HashToken(secret), Valid: true}
+	}
+
+	dbClient, err := cfg.db.CreateOAuthClient(r.Context(), database.CreateOAuthClientParams{
+		OwnerID: claims.UserID,
+		Name: name,
+		SecretHash: secretHash,
+		RedirectUris: params.RedirectURIs,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create OAuth client", err)
+		return
+	}
+
+	response := oauthClientFromDB(dbClient)
+	response.ClientSecret = secret
+
+	respondWithJSON(w, http.StatusCreated, response)
+}
+
+func (cfg *apiConfig) handlerOAuthClientsRetrieve(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
+	dbClients, err := cfg.db.GetOAuthClientsForOwner(r.Context(), claims.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get OAuth clients", err)
+		return
+	}
+
+	clients := make([]OAuthClient, 0, len(dbClients))
+	for _, dbClient := range dbClients {
+		clients = append(clients, oauthClientFromDB(dbClient))
+	}
+
+	respondWithJSON(w, http.StatusOK, clients)
+}
+
+// handlerOAuthClientDelete removes a client. Its codes and refresh tokens go
+// with it; access tokens it already holds run out within the hour.
+func (cfg *apiConfig) handlerOAuthClientDelete(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
+	clientID, err := uuid.Parse(r.PathValue("clientID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid client ID", err)
+		return
+	}
+
+	deleted, err := cfg.db.DeleteOAuthClient(r.Context(), database.DeleteOAuthClientParams{
+		ID: clientID,
+		OwnerID: claims.UserID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete OAuth client", err)
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, http.StatusNotFound, "OAuth client not found", nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerOAuthAuthorizeRetrieve checks an authorization request and
+// describes it, so the consent screen can show the signed in user which app
+// is asking for what.
+func (cfg *apiConfig) handlerOAuthAuthorizeRetrieve(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
+	type response struct {
+		ClientID uuid.UUID `json:"client_id"`
+		ClientName string `json:"client_name"`
+		RedirectURI string `json:"redirect_uri"`
+		Scopes []string `json:"scopes"`
+	}
+
+	consent, err := cfg.oauth.ValidateAuthorize(r.Context(), oauth.AuthorizeRequestFromQuery(r.URL.Query()))
+	if err != nil {
+		respondWithAuthorizeError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		ClientID: consent.Client.ID,
+		ClientName: consent.Client.Name,
+		RedirectURI: consent.RedirectURI,
+		Scopes: consent.Scopes,
+	})
+}
+
+// handlerOAuthAuthorize records the user's answer on the consent screen and
+// returns where to send their browser: back to the client with a code, or
+// with an error if they refused.
+func (cfg *apiConfig) handlerOAuthAuthorize(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
+	type parameters struct {
+		oauth.AuthorizeRequest
+		Approve bool `json:"approve"`
+	}
+	type response struct {
+		RedirectTo string `json:"redirect_to"`
+	}
+
+	var params parameters
+
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
+		return
+	}
+
+	consent, err := cfg.oauth.ValidateAuthorize(r.Context(), params.AuthorizeRequest)
+	if err != nil {
+		respondWithAuthorizeError(w, err)
+		return
+	}
+
+	if !params.Approve {
+		respondWithJSON(w, http.StatusOK, response{RedirectTo: cfg.oauth.Deny(consent)})
+		return
+	}
+
+	redirectTo, err := cfg.oauth.Approve(r.Context(), claims.UserID, consent)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create authorization code", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{RedirectTo: redirectTo})
+}
+
+// respondWithAuthorizeError sends errors the client should hear about back
+// through its redirect URI. Errors about the client or redirect URI
+// themselves can only be shown to the user.
+func respondWithAuthorizeError(w http.ResponseWriter, err error) {
+	var oauthErr *oauth.Error
+	if !errors.As(err, &oauthErr) {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't validate authorization request", err)
+		return
+	}
+
+	if redirectTo := oauthErr.RedirectURL(); redirectTo != "" {
+		respondWithJSON(w, http.StatusBadRequest, struct {
+			*oauth.Error
+			RedirectTo string `json:"redirect_to"`
+		}{oauthErr, redirectTo})
+		return
+	}
+
+	respondWithJSON(w, http.StatusBadRequest, oauthErr)
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"github.com/airlangga-hub/chirpy-go/internal/auth"
+	"github.com/airlangga-hub/chirpy-go/internal/database"
+	"github.com/airlangga-hub/chirpy-go/internal/oauth"
+	"github.com/airlangga-hub/chirpy-go/internal/oidc"
+)
+
+const (
+	oidcStateCookie = "chirpy_oidc_state"
+	oidcStateTTL = 10 * time.Minute
+)
+
+var oidcProviderNamePattern = regexp.MustCompile(`^[a-z0-9-]{1,30}$`)
+
+var (
+	errOIDCEmailUnverified = errors.New("Provider hasn't verified your email address")
+	errOIDCAccountUnverified = errors.New("An account with this email exists but its email isn't verified; log in with your password and verify it first")
+)
+
+func (cfg *apiConfig) handlerOIDCProviders(w http.ResponseWriter, r *http.Request) {
+	type provider struct {
+		Name string `json:"name"`
+		LoginURL string `json:"login_url"`
+	}
+
+	names := make([]string, 0, len(cfg.oidcProviders))
+	for name := range cfg.oidcProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	providers := make([]provider, 0, len(names))
+	for _, name := range names {
+		providers = append(providers, provider{
+			Name: name,
+			LoginURL: cfg.publicURL + "/api/oidc/" + name + "/login",
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, providers)
+}
+
+// handlerOIDCLogin starts signing in with an identity provider. The state
+// goes in a cookie as well as the database, so only the browser that started
+// the login can finish it.
+func (cfg *apiConfig) handlerOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	provider, ok := cfg.oidcProviders[r.PathValue("provider")]
+	if !ok {
+		respondWithError(w, http.StatusNotFound, "Identity provider not found", nil)
+		return
+	}
+
+	if err := cfg.db.DeleteExpiredOIDCLoginStates(r.Context()); err != nil {
+		log.Printf("Error deleting expired OIDC login states: %s", err)
+	}
+
+	state := auth.MakeRefreshToken()
+	nonce := auth.MakeRefreshToken()
+	verifier := auth.MakeRefreshToken()
+
+	authURL, err := provider.AuthCodeURL(r.Context(), cfg.oidcRedirectURI(provider), state, nonce, oauth.ChallengeS256(verifier))
+	if err != nil {
+		respondWithError(w, http.StatusBadGateway, "Couldn't reach identity provider", err)
+		return
+	}
+
+	if err := cfg.db.CreateOIDCLoginState(r.Context(), database.CreateOIDCLoginStateParams{
+		StateHash: auth.HashToken(state),
+		Provider: provider.Name(),
+		Nonce: nonce,
+		CodeVerifier: verifier,
+		ExpiresAt: time.Now().UTC().Add(oidcStateTTL),
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't start login", err)
+		return
+	}
+
+	http.SetCookie(w, cfg.oidcStateCookie(state, int(oidcStateTTL.Seconds())))
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// handlerOIDCCallback finishes signing in: it checks the state, trades the
+// code for an ID token, and logs in the linked user, or links or creates one
+// by verified email.
+func (cfg *apiConfig) handlerOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	provider, ok := cfg.oidcProviders[r.PathValue("provider")]
+	if !ok {
+		respondWithError(w, http.StatusNotFound, "Identity provider not found", nil)
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Get("error") != "" {
+		respondWithError(w, http.StatusUnauthorized, "Sign-in failed at the identity provider: "+query.Get("error"), nil)
+		return
+	}
+
+	state := query.Get("state")
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || state == "" || cookie.Value != state {
+		respondWithError(w, http.StatusBadRequest, "Login state doesn't match this browser", err)
+		return
+	}
+	http.SetCookie(w, cfg.oidcStateCookie("", -1))
+
+	loginState, err := cfg.db.ConsumeOIDCLoginState(r.Context(), database.ConsumeOIDCLoginStateParams{
+		StateHash: auth.HashToken(state),
+		Provider: provider.Name(),
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusBadRequest, "Login state expired or already used", err)
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get login state", err)
+		}
+		return
+	}
+
+	rawIDToken, err := provider.Exchange(r.Context(), query.Get("code"), loginState.CodeVerifier, cfg.oidcRedirectURI(provider))
+	if err != nil {
+		respondWithError(w, http.StatusBadGateway, "Couldn't complete sign-in with identity provider", err)
+		return
+	}
+
+	idToken, err := provider.VerifyIDToken(r.Context(), rawIDToken, loginState.Nonce)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid ID token", err)
+		return
+	}
+
+	user, err := cfg.userForIdentity(r.Context(), provider.Name(), idToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, errOIDCEmailUnverified):
+			respondWithError(w, http.StatusForbidden, err.Error(), err)
+		case errors.Is(err, errOIDCAccountUnverified):
+			respondWithError(w, http.StatusConflict, err.Error(), err)
+		default:
+			respondWithError(w, http.StatusInternalServerError, "Couldn't sign in", err)
+		}
+		return
+	}
+
+	cfg.respondWithLogin(w, r, user)
+}
+
+// userForIdentity finds the user an ID token belongs to. Known identities
+// keep their user even if the email changes. Otherwise the provider must have
+// verified the email: it's linked to the existing account with that email,
+// as long as Chirpy verified it too, or a new user is created.
+func (cfg *apiConfig) userForIdentity(ctx context.Context, provider string, idToken oidc.IDToken) (database.User, error) {
+	identity, err := cfg.db.GetUserIdentity(ctx, database.GetUserIdentityParams{
+		Provider: provider,
+		Subject: idToken.Subject,
+	})
+	if err == nil {
+		if err := cfg.db.TouchUserIdentity(ctx, database.TouchUserIdentityParams{
+			Provider: provider,
+			Subject: idToken.Subject,
+			Email: idToken.Email,
+		}); err != nil {
+			log.Printf("Error updating identity %s/%s: %s", provider, idToken.Subject, err)
+		}
+		return cfg.db.GetUser(ctx, identity.UserID)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, err
+	}
+
+	if idToken.Email == "" || !idToken.EmailVerified {
+		return database.User{}, errOIDCEmailUnverified
+	}
+
+	tx, err := cfg.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return database.User{}, err
+	}
+	defer tx.Rollback()
+
+	qtx := cfg.db.WithTx(tx)
+
+	user, err := qtx.GetUserByEmail(ctx, idToken.Email)
+	switch {
+	case err == nil:
+		// Without this, someone could sign up with a victim's email, set a
+		// password, and wait for the victim's SSO login to be linked to it.
+		if !user.EmailVerifiedAt.Valid {
+			return database.User{}, errOIDCAccountUnverified
+		}
+
+	case errors.Is(err, sql.ErrNoRows):
+		// SSO users get a random password; they can set a real one with a
+		// password reset.
+		hashedPassword, err := auth.HashPassword(auth.MakeRefreshToken())
+		if err != nil {
+			return database.User{}, err
+		}
+
+		user, err = qtx.CreateUser(ctx, database.CreateUserParams{
+			Email: idToken.Email,
+			HashedPassword: hashedPassword,
+			Handle: generateHandle(),
+		})
+		if err != nil {
+			return database.User{}, err
+		}
+
+		user, err = qtx.VerifyUserEmail(ctx, database.VerifyUserEmailParams{
+			Email: user.Email,
+			ID: user.ID,
+		})
+		if err != nil {
+			return database.User{}, err
+		}
+
+	default:
+		return database.User{}, err
+	}
+
+	if err := qtx.CreateUserIdentity(ctx, database.CreateUserIdentityParams{
+		Provider: provider,
+		Subject: idToken.Subject,
+		UserID: user.ID,
+		Email: idToken.Email,
+	}); err != nil {
+		return database.User{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return database.User{}, err
+	}
+
+	return user, nil
+}
+
+func (cfg *apiConfig) oidcRedirectURI(provider *oidc.Provider) string {
+	return cfg.publicURL + "/api/oidc/" + provider.Name() + "/callback"
+}
+
+func (cfg *apiConfig) oidcStateCookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name: oidcStateCookie,
+		Value: value,
+		Path: "/api/oidc/",
+		MaxAge: maxAge,
+		HttpOnly: true,
+		Secure: strings.HasPrefix(cfg.publicURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	}
+}
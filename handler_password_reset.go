@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+	"github.com/airlangga-hub/chirpy-go/internal/auth"
+	"github.com/airlangga-hub/chirpy-go/internal/database"
+	"github.com/airlangga-hub/chirpy-go/internal/mailer"
+)
+
+const (
+	passwordResetTTL = time.Hour
+	passwordResetMailTimeout = 30 * time.Second
+	passwordResetCooldown = time.Minute
+	passwordResetHourlyLimit = 5
+)
+
+var errPasswordResetThrottled = errors.New("Too many password reset emails, try again later")
+
+func (cfg *apiConfig) handlerPasswordForgot(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Email string `json:"email"`
+	}
+
+	var params parameters
+
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
+		return
+	}
+
+	// The lookup and email happen after responding so that neither the
+	// status nor the timing reveals whether the account exists.
+	go func(email string) {
+		ctx, cancel := context.WithTimeout(context.Background(), passwordResetMailTimeout)
+		defer cancel()
+
+		if err := cfg.sendPasswordResetEmail(ctx, email); err != nil {
+			log.Printf("Error sending password reset email: %s", err)
+		}
+	}(params.Email)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// sendPasswordResetEmail mails a reset token to the account with email, if
+// there is one, unless it has been sent one in the last minute or five in
+// the last hour, so forgot password can't be used to flood an inbox.
+func (cfg *apiConfig) sendPasswordResetEmail(ctx context.Context, email string) error {
+	user, err := cfg.db.GetUserByEmail(ctx, email)
+	if err != nil {
+		return nil
+	}
+
+	now := time.Now().UTC()
+
+	recent, err := cfg.db.CountPasswordResetTokensSince(ctx, database.CountPasswordResetTokensSinceParams{
+		UserID: user.ID,
+		CreatedAt: now.Add(-passwordResetCooldown),
+	})
+	if err != nil {
+		return err
+	}
+	hourly, err := cfg.db.CountPasswordResetTokensSince(ctx, database.CountPasswordResetTokensSinceParams{
+		UserID: user.ID,
+		CreatedAt: now.Add(-time.Hour),
+	})
+	if err != nil {
+		return err
+	}
+	if recent > 0 || hourly >= passwordResetHourlyLimit {
+		return errPasswordResetThrottled
+	}
+
+	return cfg.mailPasswordReset(ctx, user)
+}
+
+// mailPasswordReset issues a new reset token for user and mails it.
+func (cfg *apiConfig) mailPasswordReset(ctx context.Context, user database.User) error {
+	token := auth.MakeRefreshToken()
+
+	if _, err := cfg.db.CreatePasswordResetToken(ctx, database.CreatePasswordResetTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID: user.ID,
+		ExpiresAt: time.Now().UTC().Add(passwordResetTTL),
+	}); err != nil {
+		return err
+	}
+
+	return cfg.mailer.Send(ctx, mailer.Message{
+		To: user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf(
+			"Someone asked to reset the password for this account. If it was you, send this token with your new password to POST /api/password/reset within an hour:\n\n%s\n\nIf it wasn't you, you can ignore this email.\n",
+			token,
+		),
+	})
+}
+
+func (cfg *apiConfig) handlerPasswordReset(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	var params parameters
+
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
+		return
+	}
+
+	resetToken, err := cfg.db.GetPasswordResetToken(r.Context(), auth.HashToken(params.Token))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired reset token", err)
+		return
+	}
+
+	user, err := cfg.db.GetUser(r.Context(), resetToken.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+
+	if errs := cfg.passwordFieldErrors("password", params.Password, user.Email, user.Handle); len(errs) > 0 {
+		respondWithFieldErrors(w, errs)
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(params.Password)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't hash password", err)
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reset password", err)
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := cfg.db.WithTx(tx)
+
+	// Using the token is what decides which of two concurrent requests with
+	// it gets to set the password.
+	userID, err := qtx.UsePasswordResetToken(r.Context(), resetToken.TokenHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusBadRequest, "Invalid or expired reset token", err)
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't reset password", err)
+		}
+		return
+	}
+	if userID != resetToken.UserID {
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired reset token", nil)
+		return
+	}
+
+	if err := qtx.MarkPasswordResetTokensUsed(r.Context(), resetToken.UserID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reset password", err)
+		return
+	}
+
+	if err := qtx.UpdateUserPassword(r.Context(), database.UpdateUserPasswordParams{
+		HashedPassword: hashedPassword,
+		ID: resetToken.UserID,
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reset password", err)
+		return
+	}
+
+	if err := qtx.RevokeAllRefreshTokensForUser(r.Context(), resetToken.UserID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke sessions", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reset password", err)
+		return
+	}
+
+	if err := cfg.revokeAllAccessTokens(r.Context(), resetToken.UserID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke access tokens", err)
+		return
+	}
+
+	cfg.audit(r, auditEvent{
+		Action: auditPasswordReset,
+		ActorID: user.ID,
+		TargetID: user.ID,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
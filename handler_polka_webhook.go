@@ -7,6 +7,7 @@ import (
 	"database/sql"
 	"errors"
 	"github.com/airlangga-hub/chirpy-go/internal/auth"
+	"github.com/airlangga-hub/chirpy-go/internal/database"
 )
 
 func (cfg *apiConfig) handlerPolkaWebhook(w http.ResponseWriter, r *http.Request) {
@@ -39,15 +40,30 @@ func (cfg *apiConfig) handlerPolkaWebhook(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err = cfg.db.UpdateUserChirpyRed(r.Context(), params.Data.UserID)
+	user, err := cfg.db.GetUser(r.Context(), params.Data.UserID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			respondWithError(w, http.StatusNotFound, "User not found", err)
 		} else {
 			respondWithError(w, http.StatusInternalServerError, "DB error", err)
 		}
-    return
+		return
+	}
+
+	upgraded, err := cfg.db.SetUserChirpyRed(r.Context(), database.SetUserChirpyRedParams{
+		IsChirpyRed: true,
+		ID: user.ID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "DB error", err)
+		return
 	}
 
+	cfg.audit(r, auditEvent{
+		Action: auditPolkaUpgrade,
+		TargetID: user.ID,
+		Diff: auditDiff(cfg.userFromDB(user), cfg.userFromDB(upgraded)),
+	})
+
 	w.WriteHeader(http.StatusNoContent)
 }
\ No newline at end of file
@@ -1,14 +1,22 @@
 package main
 
 import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"github.com/airlangga-hub/chirpy-go/internal/auth"
-	"time"
+	"github.com/google/uuid"
 )
 
+// handlerRefresh trades a refresh token for a new access token and a new
+// refresh token. The old refresh token stops working, and presenting it again
+// is treated as theft: the whole token family is revoked.
 func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 	type response struct {
 		Token string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
 	}
 
 	refreshToken, err := auth.GetBearerToken(r.Header)
@@ -17,19 +25,26 @@ func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := cfg.db.GetUserByRefreshToken(r.Context(), refreshToken)
+	dbToken, newRefreshToken, err := cfg.rotateRefreshToken(r, refreshToken, uuid.NullUUID{})
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't get user by refresh token", err)
+		if errors.Is(err, errInvalidRefreshToken) {
+			respondWithError(w, http.StatusUnauthorized, "Invalid refresh token", err)
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't refresh session", err)
+		}
 		return
 	}
 
-	accessToken, err := auth.MakeJWT(user.ID, cfg.jwtSecret, time.Hour)
+	accessToken, err := auth.MakeJWT(dbToken.UserID, cfg.jwtKeys, accessTokenTTL)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Couldn't create access token", err)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, response{Token: accessToken})
+	respondWithJSON(w, http.StatusOK, response{
+		Token: accessToken,
+		RefreshToken: newRefreshToken,
+	})
 }
 
 func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
@@ -39,11 +54,74 @@ func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = cfg.db.RevokeRefreshToken(r.Context(), refreshToken)
+	dbToken, err := cfg.db.GetRefreshToken(r.Context(), auth.HashToken(refreshToken))
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "Refresh token not found", err)
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get refresh token", err)
+		}
+		return
+	}
+
+	if err := cfg.db.RevokeRefreshTokenFamily(r.Context(), dbToken.FamilyID); err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke session", err)
 		return
 	}
 
+	cfg.audit(r, auditEvent{
+		Action: auditTokenRevoke,
+		ActorID: dbToken.UserID,
+		TargetID: dbToken.UserID,
+		Details: map[string]any{"family_id": dbToken.FamilyID},
+	})
+
 	w.WriteHeader(http.StatusNoContent)
-}
\ No newline at end of file
+}
+
+// handlerLogout ends the session immediately: the access token in the
+// Authorization header is revoked along with the refresh token family, if a
+// refresh_token is given.
+func (cfg *apiConfig) handlerLogout(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
+	type parameters struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	if claims.ID == "" {
+		respondWithError(w, http.StatusBadRequest, "API keys are revoked with DELETE /api/api-keys/{keyID}", nil)
+		return
+	}
+
+	var params parameters
+
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil && !errors.Is(err, io.EOF) {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
+		return
+	}
+
+	if params.RefreshToken != "" && claims.Impersonated() {
+		respondWithError(w, http.StatusForbidden, "Impersonation tokens can only log themselves out", nil)
+		return
+	}
+
+	if params.RefreshToken != "" {
+		dbToken, err := cfg.db.GetRefreshToken(r.Context(), auth.HashToken(params.RefreshToken))
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get refresh token", err)
+			return
+		}
+		if err == nil && dbToken.UserID == claims.UserID {
+			if err := cfg.db.RevokeRefreshTokenFamily(r.Context(), dbToken.FamilyID); err != nil {
+				respondWithError(w, http.StatusInternalServerError, "Couldn't revoke session", err)
+				return
+			}
+		}
+	}
+
+	if err := cfg.revocations.RevokeToken(r.Context(), claims.ID, claims.ExpiresAt); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke access token", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"time"
+	"github.com/airlangga-hub/chirpy-go/internal/auth"
+	"github.com/airlangga-hub/chirpy-go/internal/database"
+	"github.com/google/uuid"
+)
+
+// A Session is one login: the chain of refresh tokens rotated out of it
+// share a family ID, which doubles as the session ID.
+type Session struct {
+	ID         uuid.UUID `json:"id"`
+	SignedInAt time.Time `json:"signed_in_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+}
+
+func (cfg *apiConfig) handlerSessionsRetrieve(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
+	userID := claims.UserID
+
+	rows, err := cfg.db.GetSessionsForUser(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get sessions", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, sessionsFromDB(rows))
+}
+
+func sessionsFromDB(rows []database.GetSessionsForUserRow) []Session {
+	sessions := make([]Session, 0, len(rows))
+	for _, row := range rows {
+		sessions = append(sessions, Session{
+			ID: row.FamilyID,
+			SignedInAt: row.SignedInAt,
+			LastUsedAt: row.LastUsedAt,
+			ExpiresAt: row.ExpiresAt,
+			UserAgent: row.UserAgent,
+			IPAddress: row.IpAddress,
+		})
+	}
+	return sessions
+}
+
+func (cfg *apiConfig) handlerSessionDelete(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
+	sessionID, err := uuid.Parse(r.PathValue("sessionID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid session ID", err)
+		return
+	}
+
+	userID := claims.UserID
+
+	revoked, err := cfg.db.RevokeSession(r.Context(), database.RevokeSessionParams{
+		FamilyID: sessionID,
+		UserID: userID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke session", err)
+		return
+	}
+	if revoked == 0 {
+		respondWithError(w, http.StatusNotFound, "Session not found", nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerSessionsRevokeAll logs the user out everywhere. Besides revoking
+// every refresh token it revokes the access tokens that haven't expired yet.
+func (cfg *apiConfig) handlerSessionsRevokeAll(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
+	userID := claims.UserID
+
+	if err := cfg.db.RevokeAllRefreshTokensForUser(r.Context(), userID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke sessions", err)
+		return
+	}
+
+	if err := cfg.revokeAllAccessTokens(r.Context(), userID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke access tokens", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
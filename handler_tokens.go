@@ -0,0 +1,143 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+	"github.com/airlangga-hub/chirpy-go/internal/auth"
+	"github.com/airlangga-hub/chirpy-go/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPersonalTokenTTL = 30 * 24 * time.Hour
+	maxPersonalTokenTTL = 365 * 24 * time.Hour
+	maxTokenNameLength = 100
+)
+
+// PersonalAccessToken describes a scoped token minted for bots and scripts.
+// Token is only set in the response that creates it.
+type PersonalAccessToken struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Name      string    `json:"name"`
+	Scopes    []string  `json:"scopes"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Token     string    `json:"token,omitempty"`
+}
+
+func personalAccessTokenFromDB(token database.PersonalAccessToken) PersonalAccessToken {
+	return PersonalAccessToken{
+		ID: token.ID,
+		CreatedAt: token.CreatedAt,
+		Name: token.Name,
+		Scopes: token.Scopes,
+		ExpiresAt: token.ExpiresAt,
+	}
+}
+
+func (cfg *apiConfig) handlerTokensCreate(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
+	type parameters struct {
+		Name string `json:"name"`
+		Scopes []string `json:"scopes"`
+		ExpiresInDays int `json:"expires_in_days"`
+	}
+
+	var params parameters
+
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
+		return
+	}
+
+	name := strings.TrimSpace(params.Name)
+	if name == "" || len(name) > maxTokenNameLength {
+		respondWithError(w, http.StatusBadRequest, "Name must be 1-100 characters", nil)
+		return
+	}
+
+	if err := auth.ValidateScopes(params.Scopes, auth.DelegableScopes); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	ttl := defaultPersonalTokenTTL
+	if params.ExpiresInDays != 0 {
+		ttl = time.Duration(params.ExpiresInDays) * 24 * time.Hour
+	}
+	if ttl <= 0 || ttl > maxPersonalTokenTTL {
+		respondWithError(w, http.StatusBadRequest, "Tokens must expire within 365 days", nil)
+		return
+	}
+
+	tokenID := uuid.New()
+
+	token, err := auth.MakeScopedJWT(claims.UserID, cfg.jwtKeys, ttl, tokenID.String(), params.Scopes)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create token", err)
+		return
+	}
+
+	dbToken, err := cfg.db.CreatePersonalAccessToken(r.Context(), database.CreatePersonalAccessTokenParams{
+		ID: tokenID,
+		UserID: claims.UserID,
+		Name: name,
+		Scopes: params.Scopes,
+		ExpiresAt: time.Now().UTC().Add(ttl),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create token", err)
+		return
+	}
+
+	response := personalAccessTokenFromDB(dbToken)
+	response.Token = token
+
+	respondWithJSON(w, http.StatusCreated, response)
+}
+
+func (cfg *apiConfig) handlerTokensRetrieve(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
+	dbTokens, err := cfg.db.GetPersonalAccessTokensForUser(r.Context(), claims.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get tokens", err)
+		return
+	}
+
+	tokens := make([]PersonalAccessToken, 0, len(dbTokens))
+	for _, dbToken := range dbTokens {
+		tokens = append(tokens, personalAccessTokenFromDB(dbToken))
+	}
+
+	respondWithJSON(w, http.StatusOK, tokens)
+}
+
+func (cfg *apiConfig) handlerTokenDelete(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
+	tokenID, err := uuid.Parse(r.PathValue("tokenID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid token ID", err)
+		return
+	}
+
+	dbToken, err := cfg.db.RevokePersonalAccessToken(r.Context(), database.RevokePersonalAccessTokenParams{
+		ID: tokenID,
+		UserID: claims.UserID,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "Token not found", err)
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't revoke token", err)
+		}
+		return
+	}
+
+	if err := cfg.revocations.RevokeToken(r.Context(), dbToken.ID.String(), dbToken.ExpiresAt); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke token", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"encoding/json"
+	"log"
 	"net/http"
+	"strings"
 	"time"
 	"github.com/google/uuid"
 	"github.com/airlangga-hub/chirpy-go/internal/database"
@@ -15,12 +17,52 @@ type User struct {
 	UpdatedAt	time.Time	`json:"updated_at"`
 	Email		string		`json:"email"`
 	IsChirpyRed	bool		`json:"is_chirpy_red"`
+	Handle		string		`json:"handle"`
+	DisplayName	string		`json:"display_name"`
+	Bio			string		`json:"bio"`
+	Location	string		`json:"location"`
+	Website		string		`json:"website"`
+	Avatar		map[string]string	`json:"avatar"`
+	Banner		map[string]string	`json:"banner"`
+	EmailVerified	bool		`json:"email_verified"`
+	PendingEmail	*string		`json:"pending_email,omitempty"`
+	TOTPEnabled	bool		`json:"totp_enabled"`
+	Role		string		`json:"role"`
+	DMPolicy	string		`json:"dm_policy"`
+}
+
+func (cfg *apiConfig) userFromDB(user database.User) User {
+	var pendingEmail *string
+	if user.PendingEmail.Valid {
+		pendingEmail = &user.PendingEmail.String
+	}
+
+	return User{
+		ID: user.ID,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+		Email: user.Email,
+		IsChirpyRed: user.IsChirpyRed,
+		Handle: user.Handle,
+		DisplayName: user.DisplayName,
+		Bio: user.Bio,
+		Location: user.Location,
+		Website: user.Website,
+		Avatar: cfg.imageURLs(user.AvatarKey, avatarVariants),
+		Banner: cfg.imageURLs(user.BannerKey, bannerVariants),
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		PendingEmail: pendingEmail,
+		TOTPEnabled: user.TotpEnabledAt.Valid,
+		Role: user.Role,
+		DMPolicy: user.DmPolicy,
+	}
 }
 
 func (cfg *apiConfig) handlerUsersCreate(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
 		Email string `json:"email"`
 		Password string `json:"password"`
+		Handle string `json:"handle"`
 	}
 
 	type response struct {
@@ -35,6 +77,27 @@ func (cfg *apiConfig) handlerUsersCreate(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	var errs []fieldError
+
+	if err := validateEmail(params.Email); err != nil {
+		errs = append(errs, fieldError{Field: "email", Code: "invalid", Message: err.Error()})
+	}
+
+	handle := params.Handle
+	if handle == "" {
+		handle = generateHandle()
+	}
+	if err := validateHandle(handle); err != nil {
+		errs = append(errs, fieldError{Field: "handle", Code: "invalid", Message: err.Error()})
+	}
+
+	errs = append(errs, cfg.passwordFieldErrors("password", params.Password, params.Email, handle)...)
+
+	if len(errs) > 0 {
+		respondWithFieldErrors(w, errs)
+		return
+	}
+
 	hashedPassword, err := auth.HashPassword(params.Password)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't hash password", err)
@@ -42,21 +105,28 @@ func (cfg *apiConfig) handlerUsersCreate(w http.ResponseWriter, r *http.Request)
 	}
 
 	user, err := cfg.db.CreateUser(r.Context(), database.CreateUserParams{
-		params.Email,
-		hashedPassword,
+		Email: params.Email,
+		HashedPassword: hashedPassword,
+		Handle: handle,
 	})
 	if err != nil {
+		if isUniqueViolation(err, "users_handle_lower_idx") {
+			respondWithError(w, http.StatusConflict, "Handle already taken", err)
+			return
+		}
 		respondWithError(w, http.StatusInternalServerError, "Couldn't create user", err)
 		return
 	}
 
+	if err := cfg.sendVerificationEmail(r.Context(), user.ID, user.Email); err != nil {
+		log.Printf("Error sending verification email to user %s: %s", user.ID, err)
+	}
+
 	respondWithJSON(w, http.StatusCreated, response{
-		User{
-			user.ID,
-			user.CreatedAt,
-			user.UpdatedAt,
-			user.Email,
-			user.IsChirpyRed,
-		},
+		cfg.userFromDB(user),
 	})
+}
+
+func generateHandle() string {
+	return "user_" + strings.ReplaceAll(uuid.NewString(), "-", "")[:10]
 }
\ No newline at end of file
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+	"unicode/utf8"
+	"github.com/google/uuid"
+)
+
+const (
+	maxDisplayNameLength = 50
+	maxBioLength = 160
+	maxLocationLength = 30
+	maxWebsiteLength = 100
+)
+
+var handlePattern = regexp.MustCompile(`^[A-Za-z0-9_]{3,30}$`)
+
+// Profile is the public view of a user. It must never carry the email.
+type Profile struct {
+	ID          uuid.UUID `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	Handle      string    `json:"handle"`
+	DisplayName string    `json:"display_name"`
+	Bio         string    `json:"bio"`
+	Location    string    `json:"location"`
+	Website     string    `json:"website"`
+	Avatar      map[string]string `json:"avatar"`
+	Banner      map[string]string `json:"banner"`
+	IsChirpyRed bool      `json:"is_chirpy_red"`
+	ChirpCount  int64     `json:"chirp_count"`
+	FollowerCount int64 `json:"follower_count"`
+	FollowingCount int64 `json:"following_count"`
+}
+
+func (cfg *apiConfig) handlerUsersGet(w http.ResponseWriter, r *http.Request) {
+	user, err := cfg.db.GetUserByHandle(r.Context(), r.PathValue("handle"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "User not found", err)
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		}
+		return
+	}
+
+	chirpCount, err := cfg.db.CountChirpsByUser(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't count chirps", err)
+		return
+	}
+
+	followerCount, err := cfg.db.CountFollowers(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't count followers", err)
+		return
+	}
+
+	followingCount, err := cfg.db.CountFollowing(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't count followed users", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, Profile{
+		ID: user.ID,
+		CreatedAt: user.CreatedAt,
+		Handle: user.Handle,
+		DisplayName: user.DisplayName,
+		Bio: user.Bio,
+		Location: user.Location,
+		Website: user.Website,
+		Avatar: cfg.imageURLs(user.AvatarKey, avatarVariants),
+		Banner: cfg.imageURLs(user.BannerKey, bannerVariants),
+		IsChirpyRed: user.IsChirpyRed,
+		ChirpCount: chirpCount,
+		FollowerCount: followerCount,
+		FollowingCount: followingCount,
+	})
+}
+
+func validateHandle(handle string) error {
+	if !handlePattern.MatchString(handle) {
+		return errors.New("Handle must be 3-30 letters, digits or underscores")
+	}
+	return nil
+}
+
+func validateProfile(handle, displayName, bio, location, website string) error {
+	if err := validateHandle(handle); err != nil {
+		return err
+	}
+	if utf8.RuneCountInString(displayName) > maxDisplayNameLength {
+		return errors.New("Max display name length 50 characters exceeded")
+	}
+	if utf8.RuneCountInString(bio) > maxBioLength {
+		return errors.New("Max bio length 160 characters exceeded")
+	}
+	if utf8.RuneCountInString(location) > maxLocationLength {
+		return errors.New("Max location length 30 characters exceeded")
+	}
+	if website == "" {
+		return nil
+	}
+	if len(website) > maxWebsiteLength {
+		return errors.New("Max website length 100 characters exceeded")
+	}
+	parsed, err := url.Parse(website)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return errors.New("Website must be an http or https URL")
+	}
+	return nil
+}
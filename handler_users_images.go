@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"github.com/airlangga-hub/chirpy-go/internal/auth"
+	"github.com/airlangga-hub/chirpy-go/internal/database"
+	"github.com/airlangga-hub/chirpy-go/internal/imaging"
+	"github.com/google/uuid"
+)
+
+const maxImageUploadSize = 10 << 20
+
+type imageVariant struct {
+	name   string
+	width  int
+	height int
+}
+
+var (
+	avatarVariants = []imageVariant{
+		{"large", 400, 400},
+		{"medium", 200, 200},
+		{"small", 48, 48},
+	}
+	bannerVariants = []imageVariant{
+		{"large", 1500, 500},
+		{"small", 600, 200},
+	}
+)
+
+func (cfg *apiConfig) handlerUsersAvatarUpload(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
+	cfg.handleProfileImageUpload(w, r, claims.UserID, "avatars", avatarVariants,
+		func(user database.User) string { return user.AvatarKey },
+		func(r *http.Request, userID uuid.UUID, key string) (database.User, error) {
+			return cfg.db.UpdateUserAvatar(r.Context(), database.UpdateUserAvatarParams{
+				AvatarKey: key,
+				ID: userID,
+			})
+		},
+	)
+}
+
+func (cfg *apiConfig) handlerUsersBannerUpload(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
+	cfg.handleProfileImageUpload(w, r, claims.UserID, "banners", bannerVariants,
+		func(user database.User) string { return user.BannerKey },
+		func(r *http.Request, userID uuid.UUID, key string) (database.User, error) {
+			return cfg.db.UpdateUserBanner(r.Context(), database.UpdateUserBannerParams{
+				BannerKey: key,
+				ID: userID,
+			})
+		},
+	)
+}
+
+// handleProfileImageUpload crops and resizes the uploaded "image" form file
+// into every variant, stores them under a fresh key, points the user at the
+// new key and then deletes the variants of the previous key.
+func (cfg *apiConfig) handleProfileImageUpload(
+	w http.ResponseWriter,
+	r *http.Request,
+	userID uuid.UUID,
+	prefix string,
+	variants []imageVariant,
+	currentKey func(database.User) string,
+	saveKey func(*http.Request, uuid.UUID, string) (database.User, error),
+) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImageUploadSize)
+	if err := r.ParseMultipartForm(maxImageUploadSize); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't parse upload", err)
+		return
+	}
+
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Missing image file", err)
+		return
+	}
+	defer file.Close()
+
+	img, _, err := imaging.Decode(file)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Unsupported or invalid image", err)
+		return
+	}
+
+	user, err := cfg.db.GetUser(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get user", err)
+		return
+	}
+
+	key := fmt.Sprintf("%s/%s/%s", prefix, userID, uuid.NewString())
+
+	var stored []string
+	for _, variant := range variants {
+		cropped := imaging.CropToAspect(img, variant.width, variant.height)
+		resized := imaging.Resize(cropped, variant.width, variant.height)
+
+		var buf bytes.Buffer
+		if err := imaging.EncodeJPEG(&buf, resized); err != nil {
+			cfg.deleteStoredImages(r, stored)
+			respondWithError(w, http.StatusInternalServerError, "Couldn't encode image", err)
+			return
+		}
+
+		variantKey := imageVariantKey(key, variant.name)
+		if err := cfg.storage.Put(r.Context(), variantKey, &buf); err != nil {
+			cfg.deleteStoredImages(r, stored)
+			respondWithError(w, http.StatusInternalServerError, "Couldn't store image", err)
+			return
+		}
+		stored = append(stored, variantKey)
+	}
+
+	userUpdated, err := saveKey(r, userID, key)
+	if err != nil {
+		cfg.deleteStoredImages(r, stored)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update user", err)
+		return
+	}
+
+	if oldKey := currentKey(user); oldKey != "" {
+		var old []string
+		for _, variant := range variants {
+			old = append(old, imageVariantKey(oldKey, variant.name))
+		}
+		cfg.deleteStoredImages(r, old)
+	}
+
+	respondWithJSON(w, http.StatusOK, cfg.userFromDB(userUpdated))
+}
+
+func (cfg *apiConfig) deleteStoredImages(r *http.Request, keys []string) {
+	for _, key := range keys {
+		if err := cfg.storage.Delete(r.Context(), key); err != nil {
+			log.Printf("Error deleting stored image %s: %s", key, err)
+		}
+	}
+}
+
+func imageVariantKey(key, variant string) string {
+	return key + "_" + variant + ".jpg"
+}
+
+func (cfg *apiConfig) imageURLs(key string, variants []imageVariant) map[string]string {
+	if key == "" {
+		return nil
+	}
+
+	urls := map[string]string{}
+	for _, variant := range variants {
+		urls[variant.name] = cfg.storage.URL(imageVariantKey(key, variant.name))
+	}
+	return urls
+}
+
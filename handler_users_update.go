@@ -1,58 +1,193 @@
 package main
 
 import (
+	"database/sql"
+	"errors"
 	"net/http"
 	"github.com/airlangga-hub/chirpy-go/internal/auth"
 	"github.com/airlangga-hub/chirpy-go/internal/database"
+	"github.com/airlangga-hub/chirpy-go/internal/social"
 	"encoding/json"
 )
 
-func (cfg *apiConfig) handlerUsersUpdate(w http.ResponseWriter, r *http.Request) {
+func (cfg *apiConfig) handlerUsersUpdate(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
 	type parameters struct {
-		Email string `json:"email"`
-		Password string `json:"password"`
+		Email *string `json:"email"`
+		Password *string `json:"password"`
+		Handle *string `json:"handle"`
+		DisplayName *string `json:"display_name"`
+		Bio *string `json:"bio"`
+		Location *string `json:"location"`
+		Website *string `json:"website"`
+		DMPolicy *string `json:"dm_policy"`
 	}
 
-	accessToken, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find access token", err)
+	userID := claims.UserID
+
+	var params parameters
+
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
 		return
 	}
 
-	userID, err := auth.ValidateJWT(accessToken, cfg.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate access token", err)
+	if params.Password != nil {
+		respondWithError(w, http.StatusBadRequest, "Use POST /api/users/password to change your password", nil)
 		return
 	}
 
-	var params parameters
+	if params.Email != nil && claims.Impersonated() {
+		respondWithError(w, http.StatusForbidden, "Not allowed while impersonating a user", nil)
+		return
+	}
 
-	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
+	if params.Email != nil && !claims.HasScope(auth.ScopeAccount) {
+		respondWithError(w, http.StatusForbidden, "Token is missing the "+auth.ScopeAccount+" scope", nil)
 		return
 	}
 
-	hashedPassword, err := auth.HashPassword(params.Password)
+	user, err := cfg.db.GetUser(r.Context(), userID)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't hash password", err)
+		respondWithError(w, http.StatusNotFound, "Couldn't get user", err)
 		return
 	}
 
-	userUpdated, err := cfg.db.UpdateUser(r.Context(), database.UpdateUserParams{
-		Email: params.Email,
-		HashedPassword: hashedPassword,
+	update := database.UpdateUserParams{
+		Handle: user.Handle,
+		DisplayName: user.DisplayName,
+		Bio: user.Bio,
+		Location: user.Location,
+		Website: user.Website,
+		DmPolicy: user.DmPolicy,
 		ID: userID,
-	})
+	}
+
+	if params.Handle != nil {
+		update.Handle = *params.Handle
+	}
+	if params.DisplayName != nil {
+		update.DisplayName = *params.DisplayName
+	}
+	if params.Bio != nil {
+		update.Bio = *params.Bio
+	}
+	if params.Location != nil {
+		update.Location = *params.Location
+	}
+	if params.Website != nil {
+		update.Website = *params.Website
+	}
+	if params.DMPolicy != nil {
+		update.DmPolicy = *params.DMPolicy
+	}
+
+	if err := validateProfile(update.Handle, update.DisplayName, update.Bio, update.Location, update.Website); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if err := social.ValidateDMPolicy(update.DmPolicy); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't update user", err)
 		return
 	}
+	defer tx.Rollback()
 
-	respondWithJSON(w, http.StatusOK, User{
-		ID: userUpdated.ID,
-		CreatedAt: userUpdated.CreatedAt,
-		UpdatedAt: userUpdated.UpdatedAt,
-		Email: userUpdated.Email,
-		IsChirpyRed: userUpdated.IsChirpyRed,
+	qtx := cfg.db.WithTx(tx)
+
+	// The verification email goes out only once both writes have committed,
+	// so a rejected handle can't leave a mailed but abandoned email change.
+	sendVerification := false
+	if params.Email != nil {
+		sendVerification, err = cfg.changeEmail(r, qtx, user, *params.Email)
+		if err != nil {
+			switch {
+			case errors.Is(err, errEmailTaken):
+				respondWithError(w, http.StatusConflict, err.Error(), err)
+			case errors.Is(err, errVerificationThrottled):
+				respondWithError(w, http.StatusTooManyRequests, err.Error(), err)
+			case errors.Is(err, errInvalidEmail):
+				respondWithError(w, http.StatusBadRequest, err.Error(), err)
+			default:
+				respondWithError(w, http.StatusInternalServerError, "Couldn't change email", err)
+			}
+			return
+		}
+	}
+
+	userUpdated, err := qtx.UpdateUser(r.Context(), update)
+	if err != nil {
+		if isUniqueViolation(err, "users_handle_lower_idx") {
+			respondWithError(w, http.StatusConflict, "Handle already taken", err)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update user", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update user", err)
+		return
+	}
+
+	if sendVerification {
+		if err := cfg.sendVerificationEmail(r.Context(), userID, *params.Email); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't send verification email", err)
+			return
+		}
+	}
+
+	cfg.audit(r, auditEvent{
+		Action: auditUserUpdate,
+		ActorID: userID,
+		TargetID: userID,
+		Diff: auditDiff(cfg.userFromDB(user), cfg.userFromDB(userUpdated)),
 	})
-}
\ No newline at end of file
+
+	respondWithJSON(w, http.StatusOK, cfg.userFromDB(userUpdated))
+}
+
+var errEmailTaken = errors.New("Email already in use")
+
+// changeEmail keeps the current address active and parks the new one as
+// pending until it has been verified. It reports whether the new address
+// still needs a verification email, which the caller sends after committing.
+func (cfg *apiConfig) changeEmail(r *http.Request, qtx *database.Queries, user database.User, email string) (bool, error) {
+	if email == user.Email {
+		if !user.PendingEmail.Valid {
+			return false, nil
+		}
+		_, err := qtx.SetUserPendingEmail(r.Context(), database.SetUserPendingEmailParams{
+			PendingEmail: sql.NullString{},
+			ID: user.ID,
+		})
+		return false, err
+	}
+
+	if err := validateEmail(email); err != nil {
+		return false, err
+	}
+
+	if _, err := qtx.GetUserByEmail(r.Context(), email); err == nil {
+		return false, errEmailTaken
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return false, err
+	}
+
+	if err := cfg.checkVerificationThrottle(r.Context(), user.ID); err != nil {
+		return false, err
+	}
+
+	if _, err := qtx.SetUserPendingEmail(r.Context(), database.SetUserPendingEmailParams{
+		PendingEmail: sql.NullString{String: email, Valid: true},
+		ID: user.ID,
+	}); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"time"
+	"github.com/airlangga-hub/chirpy-go/internal/auth"
+	"github.com/airlangga-hub/chirpy-go/internal/database"
+	"github.com/airlangga-hub/chirpy-go/internal/mailer"
+	"github.com/google/uuid"
+)
+
+const (
+	emailVerificationTTL = 24 * time.Hour
+	verificationResendCooldown = time.Minute
+	verificationResendHourlyLimit = 5
+)
+
+var (
+	errVerificationThrottled = errors.New("Too many verification emails, try again later")
+	errInvalidEmail = errors.New("Invalid email address")
+)
+
+func validateEmail(email string) error {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return errInvalidEmail
+	}
+	return nil
+}
+
+func (cfg *apiConfig) handlerUsersVerify(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token string `json:"token"`
+	}
+
+	var params parameters
+
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
+		return
+	}
+
+	cfg.verifyEmail(w, r, params.Token)
+}
+
+// handlerUsersVerifyFromEmail is where the emailed link points: the same
+// verification, with the token in the query string.
+func (cfg *apiConfig) handlerUsersVerifyFromEmail(w http.ResponseWriter, r *http.Request) {
+	cfg.verifyEmail(w, r, r.URL.Query().Get("token"))
+}
+
+func (cfg *apiConfig) verifyEmail(w http.ResponseWriter, r *http.Request, token string) {
+	tokenHash := auth.HashToken(token)
+
+	verification, err := cfg.db.GetEmailVerificationToken(r.Context(), tokenHash)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired verification token", err)
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't verify email", err)
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := cfg.db.WithTx(tx)
+
+	if err := qtx.MarkEmailVerificationTokenUsed(r.Context(), tokenHash); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't verify email", err)
+		return
+	}
+
+	user, err := qtx.VerifyUserEmail(r.Context(), database.VerifyUserEmailParams{
+		ID: verification.UserID,
+		Email: verification.Email,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusBadRequest, "Verification token is for a different email", err)
+		} else if isUniqueViolation(err, "users_email_key") {
+			respondWithError(w, http.StatusConflict, "Email already in use", err)
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't verify email", err)
+		}
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't verify email", err)
+		return
+	}
+
+	cfg.audit(r, auditEvent{
+		Action: auditEmailVerify,
+		ActorID: user.ID,
+		TargetID: user.ID,
+		Details: map[string]any{"email": verification.Email},
+	})
+
+	respondWithJSON(w, http.StatusOK, cfg.userFromDB(user))
+}
+
+func (cfg *apiConfig) handlerUsersVerifyResend(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
+	userID := claims.UserID
+
+	user, err := cfg.db.GetUser(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get user", err)
+		return
+	}
+
+	email := user.Email
+	if user.PendingEmail.Valid {
+		email = user.PendingEmail.String
+	} else if user.EmailVerifiedAt.Valid {
+		respondWithError(w, http.StatusBadRequest, "Email already verified", nil)
+		return
+	}
+
+	if err := cfg.sendVerificationEmail(r.Context(), user.ID, email); err != nil {
+		if errors.Is(err, errVerificationThrottled) {
+			respondWithError(w, http.StatusTooManyRequests, err.Error(), err)
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't send verification email", err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sendVerificationEmail issues a new token for email and mails it, unless the
+// user has asked for too many recently.
+func (cfg *apiConfig) sendVerificationEmail(ctx context.Context, userID uuid.UUID, email string) error {
+	if err := cfg.checkVerificationThrottle(ctx, userID); err != nil {
+		return err
+	}
+
+	token := auth.MakeRefreshToken()
+
+	if _, err := cfg.db.CreateEmailVerificationToken(ctx, database.CreateEmailVerificationTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID: userID,
+		Email: email,
+		ExpiresAt: time.Now().UTC().Add(emailVerificationTTL),
+	}); err != nil {
+		return err
+	}
+
+	return cfg.mailer.Send(ctx, mailer.Message{
+		To: email,
+		Subject: "Verify your Chirpy email",
+		Body: fmt.Sprintf(
+			"Confirm this address by opening the link below within 24 hours:\n\n%s/api/users/verify?token=%s\n\nOr send this token to POST /api/users/verify: %s\n",
+			cfg.publicURL,
+			token,
+			token,
+		),
+	})
+}
+
+// checkVerificationThrottle returns errVerificationThrottled if the user has
+// been sent too many verification emails recently.
+func (cfg *apiConfig) checkVerificationThrottle(ctx context.Context, userID uuid.UUID) error {
+	now := time.Now().UTC()
+
+	recent, err := cfg.db.CountEmailVerificationTokensSince(ctx, database.CountEmailVerificationTokensSinceParams{
+		UserID: userID,
+		CreatedAt: now.Add(-verificationResendCooldown),
+	})
+	if err != nil {
+		return err
+	}
+	if recent > 0 {
+		return errVerificationThrottled
+	}
+
+	hourly, err := cfg.db.CountEmailVerificationTokensSince(ctx, database.CountEmailVerificationTokensSinceParams{
+		UserID: userID,
+		CreatedAt: now.Add(-time.Hour),
+	})
+	if err != nil {
+		return err
+	}
+	if hourly >= verificationResendHourlyLimit {
+		return errVerificationThrottled
+	}
+
+	return nil
+}
+
+// requireVerifiedEmail blocks accounts that haven't confirmed their email
+// from posting.
+func (cfg *apiConfig) requireVerifiedEmail(w http.ResponseWriter, r *http.Request, userID uuid.UUID) bool {
+	user, err := cfg.db.GetUser(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get user", err)
+		return false
+	}
+	if !user.EmailVerifiedAt.Valid {
+		respondWithError(w, http.StatusForbidden, "Verify your email before posting", nil)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"github.com/airlangga-hub/chirpy-go/internal/auth"
+	"github.com/airlangga-hub/chirpy-go/internal/database"
+	"github.com/airlangga-hub/chirpy-go/internal/pubsub"
+	"github.com/airlangga-hub/chirpy-go/internal/websocket"
+	"github.com/google/uuid"
+)
+
+const (
+	wsCloseAuthRequired = 4001
+	wsCloseInvalidToken = 4002
+	wsCloseTokenExpired = 4003
+
+	wsAuthTimeout = 10 * time.Second
+	wsPingInterval = 30 * time.Second
+	// wsPongWait is how long a peer has to answer a ping before it's
+	// considered gone.
+	wsPongWait = wsPingInterval + 10*time.Second
+)
+
+type wsClientMessage struct {
+	Type  string `json:"type"`
+	Token string `json:"token,omitempty"`
+	Topic string `json:"topic,omitempty"`
+	ID    string `json:"id,omitempty"`
+}
+
+type wsServerMessage struct {
+	Type      string          `json:"type"`
+	Topic     string          `json:"topic,omitempty"`
+	Event     string          `json:"event,omitempty"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	UserID    *uuid.UUID      `json:"user_id,omitempty"`
+	ExpiresAt *time.Time      `json:"expires_at,omitempty"`
+	Error     string          `json:"error,omitempty"`
+}
+
+type wsSession struct {
+	cfg       *apiConfig
+	req       *http.Request
+	conn      *websocket.Conn
+	sub       *pubsub.Subscription
+	userID    uuid.UUID
+	claims    auth.Claims
+	scopes    []string
+	expiry    *time.Timer
+	expiryC   <-chan time.Time
+}
+
+func (cfg *apiConfig) handlerWebSocket(w http.ResponseWriter, r *http.Request) {
+	var claims auth.Claims
+	if token, err := auth.GetBearerToken(r.Header); err == nil {
+		claims, err = auth.ValidateJWT(r.Context(), token, cfg.jwtKeys, cfg.revocations)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+			return
+		}
+	}
+
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't upgrade to websocket", err)
+		return
+	}
+	defer conn.Close()
+
+	session := &wsSession{
+		cfg: cfg,
+		req: r,
+		conn: conn,
+		sub: cfg.hub.Subscribe(),
+	}
+	defer session.sub.Close()
+
+	if claims.UserID != uuid.Nil {
+		session.authenticate(claims)
+	}
+
+	session.run()
+}
+
+func (s *wsSession) run() {
+	type readResult struct {
+		data []byte
+		err  error
+	}
+
+	s.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	s.conn.SetPongHandler(func() {
+		s.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	incoming := make(chan readResult)
+	go func() {
+		for {
+			messageType, data, err := s.conn.ReadMessage()
+			if err == nil && messageType != websocket.OpText {
+				s.conn.WriteClose(websocket.CloseUnsupportedData, "Only text messages are supported")
+				err = &websocket.CloseError{Code: websocket.CloseUnsupportedData}
+			}
+			incoming <- readResult{data, err}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	defer func() {
+		s.conn.Close()
+		for result := range incoming {
+			if result.err != nil {
+				return
+			}
+		}
+	}()
+
+	authDeadline := time.NewTimer(wsAuthTimeout)
+	defer authDeadline.Stop()
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case result := <-incoming:
+			if result.err != nil {
+				return
+			}
+			if !s.handleMessage(result.data) {
+				return
+			}
+
+		case event := <-s.sub.Events():
+			if err := s.conn.WriteJSON(wsServerMessage{
+				Type: "event",
+				Topic: event.Topic,
+				Event: event.Type,
+				Data: event.Data,
+			}); err != nil {
+				return
+			}
+
+		case <-authDeadline.C:
+			if s.userID == uuid.Nil {
+				s.conn.WriteClose(wsCloseAuthRequired, "Authentication required")
+				return
+			}
+
+		case <-s.expiryC:
+			s.conn.WriteClose(wsCloseTokenExpired, "Token expired")
+			return
+
+		case <-ping.C:
+			if !s.checkRevocation() {
+				return
+			}
+			if err := s.conn.WriteMessage(websocket.OpPing, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// handleMessage processes one client message and reports whether the
+// connection should stay open.
+func (s *wsSession) handleMessage(data []byte) bool {
+	var msg wsClientMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return s.sendError("Couldn't decode message")
+	}
+
+	switch msg.Type {
+	case "ping":
+		return s.conn.WriteJSON(wsServerMessage{Type: "pong"}) == nil
+
+	case "auth":
+		claims, err := auth.ValidateJWT(context.Background(), msg.Token, s.cfg.jwtKeys, s.cfg.revocations)
+		if err != nil {
+			s.conn.WriteClose(wsCloseInvalidToken, "Couldn't validate JWT")
+			return false
+		}
+		if s.userID != uuid.Nil && claims.UserID != s.userID {
+			s.conn.WriteClose(wsCloseInvalidToken, "Token belongs to a different user")
+			return false
+		}
+		return s.authenticate(claims)
+	}
+
+	if s.userID == uuid.Nil {
+		return s.sendError("Authentication required")
+	}
+
+	switch msg.Type {
+	case "subscribe":
+		topic, err := wsTopic(s.userID, msg.Topic, msg.ID)
+		if err != nil {
+			return s.sendError(err.Error())
+		}
+		if err := s.authorizeTopic(msg.Topic, msg.ID); err != nil {
+			return s.sendError(err.Error())
+		}
+		s.sub.Add(topic)
+		return s.conn.WriteJSON(wsServerMessage{Type: "subscribed", Topic: topic}) == nil
+
+	case "unsubscribe":
+		topic, err := wsTopic(s.userID, msg.Topic, msg.ID)
+		if err != nil {
+			return s.sendError(err.Error())
+		}
+		s.sub.Remove(topic)
+		return s.conn.WriteJSON(wsServerMessage{Type: "unsubscribed", Topic: topic}) == nil
+
+	case "typing":
+		topic, err := wsTopic(s.userID, msg.Topic, msg.ID)
+		if err != nil {
+			return s.sendError(err.Error())
+		}
+		if msg.Topic == "timeline" {
+			return s.sendError("Typing presence is not supported on the timeline")
+		}
+		if err := s.authorizeTopic(msg.Topic, msg.ID); err != nil {
+			return s.sendError(err.Error())
+		}
+		event, err := pubsub.NewEvent(topic, eventTyping, struct {
+			UserID uuid.UUID `json:"user_id"`
+		}{s.userID})
+		if err != nil {
+			log.Printf("Error encoding typing event: %s", err)
+			return true
+		}
+		s.cfg.publisher.Publish(event)
+		return true
+	}
+
+	return s.sendError("Unknown message type")
+}
+
+func (s *wsSession) authenticate(claims auth.Claims) bool {
+	if claims.Impersonated() {
+		s.cfg.auditImpersonation(withImpersonator(s.req, claims.ActorID), claims)
+	}
+
+	s.userID = claims.UserID
+	s.claims = claims
+	s.scopes = claims.Scopes
+
+	if s.expiry != nil {
+		s.expiry.Stop()
+	}
+	s.expiry = time.NewTimer(time.Until(claims.ExpiresAt))
+	s.expiryC = s.expiry.C
+
+	expiresAt := claims.ExpiresAt
+	return s.conn.WriteJSON(wsServerMessage{
+		Type: "auth_ok",
+		UserID: &claims.UserID,
+		ExpiresAt: &expiresAt,
+	}) == nil
+}
+
+// checkRevocation closes the connection if its token has been revoked since
+// it authenticated, by logging out, logging out everywhere or a password
+// change, and reports whether it is still open. A failed check is retried on
+// the next ping rather than dropping every connection.
+func (s *wsSession) checkRevocation() bool {
+	if s.userID == uuid.Nil {
+		return true
+	}
+
+	err := auth.CheckRevocation(context.Background(), s.cfg.revocations, s.claims)
+	if errors.Is(err, auth.ErrTokenRevoked) {
+		s.conn.WriteClose(wsCloseInvalidToken, "Token revoked")
+		return false
+	}
+	if err != nil {
+		log.Printf("Error checking websocket token revocation: %s", err)
+	}
+	return true
+}
+
+// authorizeTopic restricts conversation topics to members whose token can
+// read messages. Every other topic is public.
+func (s *wsSession) authorizeTopic(topic, id string) error {
+	if topic != "conversation" {
+		return nil
+	}
+
+	if !slices.Contains(s.scopes, auth.ScopeMessagesRead) {
+		return errors.New("Token is missing the " + auth.ScopeMessagesRead + " scope")
+	}
+
+	conversationID, err := uuid.Parse(id)
+	if err != nil {
+		return errInvalidTopicID
+	}
+
+	isMember, err := s.cfg.db.IsConversationMember(context.Background(), database.IsConversationMemberParams{
+		ConversationID: conversationID,
+		UserID: s.userID,
+	})
+	if err != nil {
+		log.Printf("Error checking conversation membership: %s", err)
+		return errors.New("Couldn't get conversation")
+	}
+	if !isMember {
+		return errors.New("Conversation not found")
+	}
+	return nil
+}
+
+func (s *wsSession) sendError(msg string) bool {
+	return s.conn.WriteJSON(wsServerMessage{Type: "error", Error: msg}) == nil
+}
+
+// wsTopic maps a client's topic and id to the pubsub topic. "timeline" is the
+// user's own home timeline.
+func wsTopic(userID uuid.UUID, topic, id string) (string, error) {
+	switch topic {
+	case "timeline":
+		return homeTopic(userID), nil
+	case "author":
+		userID, err := uuid.Parse(id)
+		if err != nil {
+			return "", errInvalidTopicID
+		}
+		return authorTopic(userID), nil
+	case "thread":
+		chirpID, err := uuid.Parse(id)
+		if err != nil {
+			return "", errInvalidTopicID
+		}
+		return threadTopic(chirpID), nil
+	case "conversation":
+		conversationID, err := uuid.Parse(id)
+		if err != nil {
+			return "", errInvalidTopicID
+		}
+		return conversationTopic(conversationID), nil
+	case "hashtag":
+		tag := strings.TrimPrefix(id, "#")
+		if tag == "" || strings.ContainsAny(tag, " \t\n") {
+			return "", errInvalidTopicID
+		}
+		return hashtagTopic(tag), nil
+	}
+	return "", errUnknownTopic
+}
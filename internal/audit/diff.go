@@ -0,0 +1,64 @@
+// Package audit describes what changed, for the audit log.
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"slices"
+)
+
+// Change is one field's value before and after.
+type Change struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
+
+// Diff compares the JSON forms of before and after and returns the top-level
+// fields that differ, keyed by their JSON names. Either side may be nil, for
+// something created or deleted. Fields named in ignore, like timestamps that
+// change on every write, are left out.
+func Diff(before, after any, ignore ...string) (map[string]Change, error) {
+	from, err := fields(before)
+	if err != nil {
+		return nil, err
+	}
+	to, err := fields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]Change{}
+	for name, value := range from {
+		if !slices.Contains(ignore, name) && !reflect.DeepEqual(value, to[name]) {
+			changes[name] = Change{From: value, To: to[name]}
+		}
+	}
+	for name, value := range to {
+		if _, ok := from[name]; !ok && !slices.Contains(ignore, name) && value != nil {
+			changes[name] = Change{To: value}
+		}
+	}
+
+	return changes, nil
+}
+
+func fields(v any) (map[string]any, error) {
+	if v == nil {
+		return map[string]any{}, nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var m map[string]any
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, errors.New("Only values that encode as JSON objects can be diffed")
+	}
+	if m == nil {
+		m = map[string]any{}
+	}
+	return m, nil
+}
@@ -0,0 +1,82 @@
+package audit
+
+import (
+	"reflect"
+	"testing"
+)
+
+type profile struct {
+	Handle    string  `json:"handle"`
+	Bio       string  `json:"bio"`
+	Pending   *string `json:"pending_email,omitempty"`
+	UpdatedAt int     `json:"updated_at"`
+}
+
+func TestDiff(t *testing.T) {
+	pending := "new@example.com"
+
+	tests := []struct {
+		name    string
+		before  any
+		after   any
+		ignore  []string
+		want    map[string]Change
+		wantErr bool
+	}{
+		{
+			name: "Unchanged",
+			before: profile{Handle: "ada", Bio: "hi"},
+			after: profile{Handle: "ada", Bio: "hi"},
+			want: map[string]Change{},
+		},
+		{
+			name: "Changed fields",
+			before: profile{Handle: "ada", Bio: "hi", UpdatedAt: 1},
+			after: profile{Handle: "ada_l", Bio: "hi", UpdatedAt: 2},
+			ignore: []string{"updated_at"},
+			want: map[string]Change{"handle": {From: "ada", To: "ada_l"}},
+		},
+		{
+			name: "Omitted field appears",
+			before: profile{Handle: "ada"},
+			after: profile{Handle: "ada", Pending: &pending},
+			want: map[string]Change{"pending_email": {To: "new@example.com"}},
+		},
+		{
+			name: "Omitted field disappears",
+			before: profile{Handle: "ada", Pending: &pending},
+			after: profile{Handle: "ada"},
+			want: map[string]Change{"pending_email": {From: "new@example.com"}},
+		},
+		{
+			name: "Created",
+			before: nil,
+			after: map[string]any{"is_chirpy_red": true},
+			want: map[string]Change{"is_chirpy_red": {To: true}},
+		},
+		{
+			name: "Deleted",
+			before: map[string]any{"body": "hello"},
+			after: nil,
+			want: map[string]Change{"body": {From: "hello"}},
+		},
+		{
+			name: "Not an object",
+			before: "ada",
+			after: "ada_l",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Diff(tt.before, tt.after, tt.ignore...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Diff() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Diff() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"context"
 	"github.com/alexedwards/argon2id"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
@@ -10,13 +11,50 @@ import (
 	"strings"
 	"net/http"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
+	"sync"
 )
 
 const ISSUER = "chirpy-access"
 
+// MFA_ISSUER marks the short-lived challenge tokens handed out between the
+// password step and the second factor. They are never valid access tokens.
+const MFA_ISSUER = "chirpy-mfa"
+
+// PasswordParams are the argon2id parameters new hashes are made with. Hashes
+// made with anything else are upgraded when their owner next logs in.
+var PasswordParams = argon2id.DefaultParams
+
+// NewPasswordParams builds argon2id parameters from a memory cost in KiB,
+// an iteration count and a degree of parallelism, refusing ones weaker than
+// the library defaults.
+func NewPasswordParams(memory, iterations uint32, parallelism uint8) (*argon2id.Params, error) {
+	if memory < argon2id.DefaultParams.Memory || iterations < argon2id.DefaultParams.Iterations || parallelism < 1 {
+		return nil, fmt.Errorf(
+			"Password hashing parameters must be at least m=%d,t=%d,p=1",
+			argon2id.DefaultParams.Memory,
+			argon2id.DefaultParams.Iterations,
+		)
+	}
+
+	return &argon2id.Params{
+		Memory: memory,
+		Iterations: iterations,
+		Parallelism: parallelism,
+		SaltLength: argon2id.DefaultParams.SaltLength,
+		KeyLength: argon2id.DefaultParams.KeyLength,
+	}, nil
+}
+
+// EncodedPasswordParams formats params the way they appear in a hash, e.g.
+// "m=65536,t=1,p=2".
+func EncodedPasswordParams(params *argon2id.Params) string {
+	return fmt.Sprintf("m=%d,t=%d,p=%d", params.Memory, params.Iterations, params.Parallelism)
+}
+
 func HashPassword(password string) (string, error) {
-	hash, err := argon2id.CreateHash(password, argon2id.DefaultParams)
+	hash, err := argon2id.CreateHash(password, PasswordParams)
 	if err != nil {
 		return "", err
 	}
@@ -31,49 +69,183 @@ func CheckPasswordHash(password, hash string) (bool, error) {
 	return match, nil
 }
 
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	signingKey := []byte(tokenSecret)
+// PasswordNeedsRehash reports whether hash was made with parameters other
+// than PasswordParams.
+func PasswordNeedsRehash(hash string) bool {
+	params, _, _, err := argon2id.DecodeHash(hash)
+	if err != nil {
+		return true
+	}
+	return *params != *PasswordParams
+}
+
+// dummyHash is compared against when there is no real hash to check, so it
+// is made with the same parameters as every other hash.
+var dummyHash = sync.OnceValue(func() string {
+	hash, _ := HashPassword("chirpy-dummy-password")
+	return hash
+})
+
+// CheckPasswordDummy does the work of CheckPasswordHash against a hash no
+// password matches. Call it when a login names an unknown account, so the
+// response takes as long as a wrong password would and doesn't reveal which
+// accounts exist.
+func CheckPasswordDummy(password string) {
+	CheckPasswordHash(password, dummyHash())
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		Issuer: ISSUER,
-		IssuedAt: jwt.NewNumericDate(time.Now()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
-		Subject: userID.String(),
+type jwtClaims struct {
+	jwt.RegisteredClaims
+	Scope *string     `json:"scope,omitempty"`
+	Act   *actorClaim `json:"act,omitempty"`
+}
+
+// actorClaim is the RFC 8693 act claim: who is acting on behalf of the
+// token's subject.
+type actorClaim struct {
+	Subject string `json:"sub"`
+}
+
+// MakeJWT creates a login session's access token with SessionScopes.
+func MakeJWT(userID uuid.UUID, keys *KeySet, expiresIn time.Duration) (string, error) {
+	return MakeScopedJWT(userID, keys, expiresIn, uuid.NewString(), SessionScopes)
+}
+
+// MakeScopedJWT creates an access token limited to scopes. jti identifies it
+// for revocation.
+func MakeScopedJWT(userID uuid.UUID, keys *KeySet, expiresIn time.Duration, jti string, scopes []string) (string, error) {
+	scope := formatScopes(scopes)
+	return makeJWT(ISSUER, userID, keys, time.Now(), expiresIn, jti, &scope, nil)
+}
+
+// MakeImpersonationJWT creates an access token for userID with an act claim
+// naming actorID, the admin using it. It only gets DelegableScopes, so it
+// can't touch the account itself: password, email, two-factor, sessions or
+// tokens.
+func MakeImpersonationJWT(userID, actorID uuid.UUID, keys *KeySet, expiresIn time.Duration, jti string) (string, error) {
+	scope := formatScopes(DelegableScopes)
+	return makeJWT(ISSUER, userID, keys, time.Now(), expiresIn, jti, &scope, &actorClaim{Subject: actorID.String()})
+}
+
+func MakeMFAToken(userID uuid.UUID, keys *KeySet, expiresIn time.Duration) (string, error) {
+	return makeJWT(MFA_ISSUER, userID, keys, time.Now(), expiresIn, uuid.NewString(), nil, nil)
+}
+
+func makeJWT(issuer string, userID uuid.UUID, keys *KeySet, issuedAt time.Time, expiresIn time.Duration, jti string, scope *string, act *actorClaim) (string, error) {
+	return keys.sign(jwtClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer: issuer,
+			IssuedAt: jwt.NewNumericDate(issuedAt),
+			ExpiresAt: jwt.NewNumericDate(issuedAt.Add(expiresIn)),
+			Subject: userID.String(),
+			ID: jti,
+		},
+		Scope: scope,
+		Act: act,
 	})
+}
 
-	return token.SignedString(signingKey)
+type Claims struct {
+	ID        string
+	UserID    uuid.UUID
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+	Scopes    []string
+	// ActorID is the admin impersonating UserID, from the act claim, or
+	// uuid.Nil for the user's own tokens.
+	ActorID uuid.UUID
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
+// Impersonated reports whether someone other than the user is acting with
+// these claims.
+func (c Claims) Impersonated() bool {
+	return c.ActorID != uuid.Nil
+}
+
+// ValidateJWT checks an access token's signature, issuer and expiry, then
+// asks store whether it has been revoked. Callers should check
+// Claims.Impersonated before allowing anything only the user may do.
+func ValidateJWT(ctx context.Context, tokenString string, keys *KeySet, store RevocationStore) (Claims, error) {
+	claims, err := ParseJWT(tokenString, keys)
+	if err != nil {
+		return Claims{}, err
+	}
+	if err := CheckRevocation(ctx, store, claims); err != nil {
+		return Claims{}, err
+	}
+	return claims, nil
+}
+
+// ValidateMFAToken checks an MFA challenge token like ValidateJWT checks an
+// access token, so a token burnt by too many wrong codes stays dead.
+func ValidateMFAToken(ctx context.Context, tokenString string, keys *KeySet, store RevocationStore) (Claims, error) {
+	claims, err := parseJWT(tokenString, keys, MFA_ISSUER)
+	if err != nil {
+		return Claims{}, err
+	}
+	if err := CheckRevocation(ctx, store, claims); err != nil {
+		return Claims{}, err
+	}
+	return claims, nil
+}
+
+func ParseJWT(tokenString string, keys *KeySet) (Claims, error) {
+	return parseJWT(tokenString, keys, ISSUER)
+}
+
+func parseJWT(tokenString string, keys *KeySet, expectedIssuer string) (Claims, error) {
+	parsedClaims := jwtClaims{}
 	token, err := jwt.ParseWithClaims(
 		tokenString,
-		&jwt.RegisteredClaims{},
-		func(token *jwt.Token) (any, error) {return []byte(tokenSecret), nil},
+		&parsedClaims,
+		keys.keyFunc,
+		jwt.WithValidMethods(keys.validMethods()),
 	)
 
 	if err != nil {
-		return uuid.Nil, err
+		return Claims{}, err
 	}
 
 	userIDString, err := token.Claims.GetSubject()
 	if err != nil {
-		return uuid.Nil, err
+		return Claims{}, err
 	}
 
 	issuer, err := token.Claims.GetIssuer()
 	if err != nil {
-		return uuid.Nil, err
+		return Claims{}, err
 	}
-	if issuer != ISSUER {
-		return uuid.Nil, errors.New("Invalid user")
+	if issuer != expectedIssuer {
+		return Claims{}, errors.New("Invalid user")
 	}
 
 	userID, err := uuid.Parse(userIDString)
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("Invalid User ID: %w", err)
+		return Claims{}, fmt.Errorf("Invalid User ID: %w", err)
 	}
 
-	return userID, nil
+	claims := Claims{ID: parsedClaims.ID, UserID: userID}
+	if parsedClaims.IssuedAt != nil {
+		claims.IssuedAt = parsedClaims.IssuedAt.Time
+	}
+	if parsedClaims.ExpiresAt != nil {
+		claims.ExpiresAt = parsedClaims.ExpiresAt.Time
+	}
+	if parsedClaims.Scope != nil {
+		claims.Scopes = parseScopes(*parsedClaims.Scope)
+	} else if expectedIssuer == ISSUER {
+		// Access tokens minted before scopes existed had full power.
+		claims.Scopes = SessionScopes
+	}
+	if parsedClaims.Act != nil {
+		actorID, err := uuid.Parse(parsedClaims.Act.Subject)
+		if err != nil || actorID == uuid.Nil {
+			return Claims{}, errors.New("Invalid act claim")
+		}
+		claims.ActorID = actorID
+	}
+
+	return claims, nil
 }
 
 
@@ -99,6 +271,26 @@ func MakeRefreshToken() string {
 }
 
 
+// HashToken returns the SHA-256 of a random single-use token so only the
+// digest needs to be stored.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+
+// APIKeyPrefix starts every user API key, telling them apart from the
+// shared webhook keys that also arrive in ApiKey headers.
+const APIKeyPrefix = "chirpy_"
+
+func MakeAPIKey() string {
+	return APIKeyPrefix + MakeRefreshToken()
+}
+
+func IsUserAPIKey(key string) bool {
+	return strings.HasPrefix(key, APIKeyPrefix)
+}
+
 func GetAPIKey(headers http.Header) (string, error) {
 	authHeader := headers.Get("Authorization")
 	if authHeader == "" {
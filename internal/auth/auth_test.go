@@ -1,6 +1,17 @@
 package auth
 
 import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"github.com/google/uuid"
 	"net/http"
@@ -74,7 +85,8 @@ func TestCheckPasswordHash(t *testing.T) {
 
 func TestValidateJWT(t *testing.T) {
 	userID := uuid.New()
-	validToken, _ := MakeJWT(userID, "secret", time.Hour)
+	validToken, _ := MakeJWT(userID, NewKeySet("secret"), time.Hour)
+	mfaToken, _ := MakeMFAToken(userID, NewKeySet("secret"), time.Minute)
 
 	tests := []struct {
 		name        string
@@ -104,22 +116,384 @@ func TestValidateJWT(t *testing.T) {
 			wantUserID:  uuid.Nil,
 			wantErr:     true,
 		},
+		{
+			name:        "MFA challenge token",
+			tokenString: mfaToken,
+			tokenSecret: "secret",
+			wantUserID:  uuid.Nil,
+			wantErr:     true,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotUserID, err := ValidateJWT(tt.tokenString, tt.tokenSecret)
+			claims, err := ValidateJWT(context.Background(), tt.tokenString, NewKeySet(tt.tokenSecret), nil)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("ValidateJWT() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if gotUserID != tt.wantUserID {
-				t.Errorf("ValidateJWT() gotUserID = %v, want %v", gotUserID, tt.wantUserID)
+			if claims.UserID != tt.wantUserID {
+				t.Errorf("ValidateJWT() UserID = %v, want %v", claims.UserID, tt.wantUserID)
+			}
+			if claims.Impersonated() {
+				t.Errorf("ValidateJWT() Impersonated() = true for the user's own token")
 			}
 		})
 	}
 }
 
+func TestValidateJWTRevocation(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryRevocationStore()
+	keys := NewKeySet("secret")
+
+	userID := uuid.New()
+	otherUserID := uuid.New()
+
+	revokedToken, _ := MakeJWT(userID, keys, time.Hour)
+	claims, _ := ParseJWT(revokedToken, keys)
+	store.RevokeToken(ctx, claims.ID, claims.ExpiresAt)
+
+	liveToken, _ := MakeJWT(userID, keys, time.Hour)
+	otherToken, _ := MakeJWT(otherUserID, keys, time.Hour)
+	store.RevokeUserTokens(ctx, otherUserID, time.Now().Add(time.Second))
+
+	tests := []struct {
+		name        string
+		tokenString string
+		wantErr     bool
+	}{
+		{
+			name:        "Revoked jti",
+			tokenString: revokedToken,
+			wantErr:     true,
+		},
+		{
+			name:        "Different jti for the same user",
+			tokenString: liveToken,
+			wantErr:     false,
+		},
+		{
+			name:        "Issued before the user's watermark",
+			tokenString: otherToken,
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ValidateJWT(ctx, tt.tokenString, keys, store)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateJWT() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, ErrTokenRevoked) {
+				t.Errorf("ValidateJWT() error = %v, want ErrTokenRevoked", err)
+			}
+		})
+	}
+}
+
+func TestRevokeUserTokensSameSecond(t *testing.T) {
+	// The watermark is truncated to the second, like JWT issue times, so a
+	// login in the same second as the revocation still works.
+	ctx := context.Background()
+	store := NewMemoryRevocationStore()
+	keys := NewKeySet("secret")
+
+	userID := uuid.New()
+	watermark := time.Now().Truncate(time.Second)
+
+	scope := formatScopes(SessionScopes)
+	earlierToken, _ := makeJWT(ISSUER, userID, keys, watermark.Add(-time.Second), time.Hour, uuid.NewString(), &scope, nil)
+
+	store.RevokeUserTokens(ctx, userID, watermark)
+
+	sameSecondToken, _ := MakeJWT(userID, keys, time.Hour)
+
+	tests := []struct {
+		name        string
+		tokenString string
+		wantErr     bool
+	}{
+		{
+			name:        "Token issued the second before",
+			tokenString: earlierToken,
+			wantErr:     true,
+		},
+		{
+			name:        "Login in the watermark's second",
+			tokenString: sameSecondToken,
+			wantErr:     false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ValidateJWT(ctx, tt.tokenString, keys, store)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateJWT() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckRevocationAPIKey(t *testing.T) {
+	// API keys have no jti, only the time they were created, so only the
+	// user's watermark can revoke them.
+	ctx := context.Background()
+	store := NewMemoryRevocationStore()
+
+	userID := uuid.New()
+	watermark := time.Now().Truncate(time.Second)
+
+	oldKey := Claims{UserID: userID, IssuedAt: watermark.Add(-time.Hour), Scopes: DelegableScopes}
+	newKey := Claims{UserID: userID, IssuedAt: watermark.Add(time.Minute), Scopes: DelegableScopes}
+
+	if err := CheckRevocation(ctx, store, oldKey); err != nil {
+		t.Fatalf("CheckRevocation() before revoking error = %v", err)
+	}
+
+	store.RevokeUserTokens(ctx, userID, watermark)
+
+	if err := CheckRevocation(ctx, store, oldKey); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("CheckRevocation() for a key created before the watermark error = %v, want ErrTokenRevoked", err)
+	}
+	if err := CheckRevocation(ctx, store, newKey); err != nil {
+		t.Errorf("CheckRevocation() for a key created after the watermark error = %v", err)
+	}
+}
+
+func TestImpersonationJWT(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryRevocationStore()
+	keys := NewKeySet("secret")
+
+	userID := uuid.New()
+	adminID := uuid.New()
+
+	token, err := MakeImpersonationJWT(userID, adminID, keys, 15*time.Minute, uuid.NewString())
+	if err != nil {
+		t.Fatalf("MakeImpersonationJWT() error = %v", err)
+	}
+
+	claims, err := ValidateJWT(ctx, token, keys, store)
+	if err != nil {
+		t.Fatalf("ValidateJWT() error = %v", err)
+	}
+	if claims.UserID != userID {
+		t.Errorf("ValidateJWT() UserID = %v, want %v", claims.UserID, userID)
+	}
+	if !claims.Impersonated() || claims.ActorID != adminID {
+		t.Errorf("ValidateJWT() ActorID = %v, want %v", claims.ActorID, adminID)
+	}
+	for _, scope := range []string{ScopeAccount, ScopeAdmin} {
+		if claims.HasScope(scope) {
+			t.Errorf("Impersonation token has the %s scope", scope)
+		}
+	}
+
+	store.RevokeUserTokens(ctx, userID, time.Now().Add(time.Second))
+	if _, err := ValidateJWT(ctx, token, keys, store); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("ValidateJWT() after revoking the user's tokens error = %v, want ErrTokenRevoked", err)
+	}
+}
+
+
+func TestKeySetRotation(t *testing.T) {
+	userID := uuid.New()
+
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	_, strangerKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	oldKeys := NewKeySet("secret")
+	oldKeys.AddKey("2026-01", rsaKey)
+
+	keys := NewKeySet("secret")
+	keys.AddKey("2026-01", rsaKey)
+	keys.AddKey("2026-10", edKey)
+	keys.SetCurrent("2026-10")
+
+	strangerKeys := NewKeySet("")
+	strangerKeys.AddKey("2026-10", strangerKey)
+
+	legacyToken, _ := MakeJWT(userID, NewKeySet("secret"), time.Hour)
+	rsaToken, _ := MakeJWT(userID, oldKeys, time.Hour)
+	edToken, _ := MakeJWT(userID, keys, time.Hour)
+	strangerToken, _ := MakeJWT(userID, strangerKeys, time.Hour)
+
+	tests := []struct {
+		name        string
+		tokenString string
+		keys        *KeySet
+		wantErr     bool
+	}{
+		{
+			name:        "Current EdDSA key",
+			tokenString: edToken,
+			keys:        keys,
+			wantErr:     false,
+		},
+		{
+			name:        "Previous RS256 key still active",
+			tokenString: rsaToken,
+			keys:        keys,
+			wantErr:     false,
+		},
+		{
+			name:        "Legacy HS256 token",
+			tokenString: legacyToken,
+			keys:        keys,
+			wantErr:     false,
+		},
+		{
+			name:        "Legacy HS256 token without legacy secret",
+			tokenString: legacyToken,
+			keys:        strangerKeys,
+			wantErr:     true,
+		},
+		{
+			name:        "Retired key",
+			tokenString: rsaToken,
+			keys:        strangerKeys,
+			wantErr:     true,
+		},
+		{
+			name:        "Known kid signed by another key",
+			tokenString: strangerToken,
+			keys:        keys,
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := ValidateJWT(context.Background(), tt.tokenString, tt.keys, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateJWT() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && claims.UserID != userID {
+				t.Errorf("ValidateJWT() UserID = %v, want %v", claims.UserID, userID)
+			}
+		})
+	}
+
+	jwks := keys.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("JWKS() returned %d keys, want 2", len(jwks.Keys))
+	}
+	if jwks.Keys[0].KeyType != "RSA" || jwks.Keys[0].Algorithm != "RS256" || jwks.Keys[0].E != "AQAB" {
+		t.Errorf("JWKS() RSA key = %+v", jwks.Keys[0])
+	}
+	if jwks.Keys[1].KeyType != "OKP" || jwks.Keys[1].Curve != "Ed25519" || jwks.Keys[1].KeyID != "2026-10" {
+		t.Errorf("JWKS() Ed25519 key = %+v", jwks.Keys[1])
+	}
+}
+
+func TestLoadKeySet(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, kid := range []string{"2026-01", "2026-10"} {
+		_, key, _ := ed25519.GenerateKey(rand.Reader)
+		der, _ := x509.MarshalPKCS8PrivateKey(key)
+		data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+		if err := os.WriteFile(filepath.Join(dir, kid+".pem"), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	keys, err := LoadKeySet(dir, "", "")
+	if err != nil {
+		t.Fatalf("LoadKeySet() error = %v", err)
+	}
+	if keys.current != "2026-10" {
+		t.Errorf("LoadKeySet() current = %q, want newest key 2026-10", keys.current)
+	}
+
+	if _, err := LoadKeySet(dir, "2027-01", ""); err == nil {
+		t.Error("LoadKeySet() with unknown current kid, want error")
+	}
+}
+
+func TestScopes(t *testing.T) {
+	keys := NewKeySet("secret")
+	userID := uuid.New()
+
+	scopedToken, _ := MakeScopedJWT(userID, keys, time.Hour, uuid.NewString(), []string{ScopeChirpsWrite})
+	sessionToken, _ := MakeJWT(userID, keys, time.Hour)
+	legacyToken, _ := keys.sign(jwt.RegisteredClaims{
+		Issuer: ISSUER,
+		Subject: userID.String(),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	})
+
+	tests := []struct {
+		name        string
+		tokenString string
+		scope       string
+		wantScope   bool
+	}{
+		{
+			name:        "Scoped token has its scope",
+			tokenString: scopedToken,
+			scope:       ScopeChirpsWrite,
+			wantScope:   true,
+		},
+		{
+			name:        "Scoped token lacks other scopes",
+			tokenString: scopedToken,
+			scope:       ScopeAccount,
+			wantScope:   false,
+		},
+		{
+			name:        "Session token has account scope",
+			tokenString: sessionToken,
+			scope:       ScopeAccount,
+			wantScope:   true,
+		},
+		{
+			name:        "Session token has admin scope",
+			tokenString: sessionToken,
+			scope:       ScopeAdmin,
+			wantScope:   true,
+		},
+		{
+			name:        "Scoped token lacks admin scope",
+			tokenString: scopedToken,
+			scope:       ScopeAdmin,
+			wantScope:   false,
+		},
+		{
+			name:        "Token without scope claim gets session scopes",
+			tokenString: legacyToken,
+			scope:       ScopeChirpsDelete,
+			wantScope:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := ParseJWT(tt.tokenString, keys)
+			if err != nil {
+				t.Fatalf("ParseJWT() error = %v", err)
+			}
+			if got := claims.HasScope(tt.scope); got != tt.wantScope {
+				t.Errorf("HasScope(%q) = %v, want %v (scopes %v)", tt.scope, got, tt.wantScope, claims.Scopes)
+			}
+		})
+	}
+
+	if err := ValidateScopes([]string{ScopeChirpsWrite, ScopeProfileWrite}, DelegableScopes); err != nil {
+		t.Errorf("ValidateScopes() error = %v", err)
+	}
+	if err := ValidateScopes([]string{ScopeAccount}, DelegableScopes); err == nil {
+		t.Error("ValidateScopes() with account scope, want error")
+	}
+	if err := ValidateScopes(nil, DelegableScopes); err == nil {
+		t.Error("ValidateScopes() with no scopes, want error")
+	}
+}
 
 func TestGetBearerToken(t *testing.T) {
 	tests := []struct {
@@ -164,4 +538,161 @@ func TestGetBearerToken(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+func TestMakeAPIKey(t *testing.T) {
+	key := MakeAPIKey()
+	if !IsUserAPIKey(key) {
+		t.Errorf("IsUserAPIKey(%q) = false, want true", key)
+	}
+	if key == MakeAPIKey() {
+		t.Error("MakeAPIKey() returned the same key twice")
+	}
+
+	headers := http.Header{"Authorization": []string{"ApiKey " + key}}
+	got, err := GetAPIKey(headers)
+	if err != nil || got != key {
+		t.Errorf("GetAPIKey() = %q, %v, want %q", got, err, key)
+	}
+
+	if IsUserAPIKey("f271c81ff7084ee5b99a5091b42d486e") {
+		t.Error("IsUserAPIKey() accepted a webhook key")
+	}
+}
+
+func TestPasswordNeedsRehash(t *testing.T) {
+	oldHash, err := HashPassword("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stronger, err := NewPasswordParams(128*1024, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defaults := PasswordParams
+	PasswordParams = stronger
+	t.Cleanup(func() { PasswordParams = defaults })
+
+	if !PasswordNeedsRehash(oldHash) {
+		t.Error("PasswordNeedsRehash() = false for a hash with old parameters")
+	}
+
+	newHash, err := HashPassword("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if PasswordNeedsRehash(newHash) {
+		t.Error("PasswordNeedsRehash() = true for a hash with current parameters")
+	}
+	if !strings.Contains(newHash, "$"+EncodedPasswordParams(stronger)+"$") {
+		t.Errorf("HashPassword() = %s, want parameters %s", newHash, EncodedPasswordParams(stronger))
+	}
+
+	if match, err := CheckPasswordHash("password", oldHash); !match || err != nil {
+		t.Errorf("CheckPasswordHash() on an old hash = %v, %v", match, err)
+	}
+
+	if _, err := NewPasswordParams(1024, 1, 1); err == nil {
+		t.Error("NewPasswordParams() accepted parameters weaker than the defaults")
+	}
+}
+
+func TestLoginThrottle(t *testing.T) {
+	throttle := LoginThrottle{
+		FreeAttempts: 3,
+		BaseDelay: time.Second,
+		MaxDelay: 30 * time.Second,
+		LockoutAfter: 10,
+		LockoutDuration: 15 * time.Minute,
+		ResetAfter: 24 * time.Hour,
+	}
+	last := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		failures int
+		now      time.Time
+		want     time.Duration
+	}{
+		{name: "Free attempts", failures: 3, now: last, want: 0},
+		{name: "First delay", failures: 4, now: last, want: time.Second},
+		{name: "Doubles", failures: 6, now: last, want: 4 * time.Second},
+		{name: "Capped", failures: 9, now: last, want: 30 * time.Second},
+		{name: "Partly waited", failures: 6, now: last.Add(3 * time.Second), want: time.Second},
+		{name: "Waited out", failures: 6, now: last.Add(time.Minute), want: 0},
+		{name: "Locked out", failures: 10, now: last.Add(time.Minute), want: 14 * time.Minute},
+		{name: "Reset", failures: 50, now: last.Add(25 * time.Hour), want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := throttle.RetryAfter(tt.failures, last, tt.now); got != tt.want {
+				t.Errorf("RetryAfter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMFATokenThrottle(t *testing.T) {
+	issued := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for failures := 0; failures < MFATokenMaxFailures; failures++ {
+		if got := MFATokenThrottle.RetryAfter(failures, issued, issued); got != 0 {
+			t.Errorf("RetryAfter(%d) = %v, want 0", failures, got)
+		}
+	}
+
+	// Burnt for longer than any MFA token lives.
+	if got := MFATokenThrottle.RetryAfter(MFATokenMaxFailures, issued, issued.Add(30*time.Minute)); got < 30*time.Minute {
+		t.Errorf("RetryAfter(%d) = %v, want at least 30m", MFATokenMaxFailures, got)
+	}
+}
+
+func TestValidateMFATokenRevocation(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryRevocationStore()
+	keys := NewKeySet("secret")
+	userID := uuid.New()
+
+	token, _ := MakeMFAToken(userID, keys, 5*time.Minute)
+
+	claims, err := ValidateMFAToken(ctx, token, keys, store)
+	if err != nil || claims.UserID != userID || claims.ID == "" {
+		t.Fatalf("ValidateMFAToken() = %+v, %v", claims, err)
+	}
+
+	store.RevokeToken(ctx, claims.ID, claims.ExpiresAt)
+	if _, err := ValidateMFAToken(ctx, token, keys, store); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("ValidateMFAToken() of a burnt token error = %v, want ErrTokenRevoked", err)
+	}
+
+	accessToken, _ := MakeJWT(userID, keys, time.Hour)
+	if _, err := ValidateMFAToken(ctx, accessToken, keys, store); err == nil {
+		t.Errorf("ValidateMFAToken() accepted an access token")
+	}
+}
+
+func TestHasRole(t *testing.T) {
+	tests := []struct {
+		role     string
+		required string
+		want     bool
+	}{
+		{role: RoleAdmin, required: RoleAdmin, want: true},
+		{role: RoleAdmin, required: RoleModerator, want: true},
+		{role: RoleModerator, required: RoleAdmin, want: false},
+		{role: RoleModerator, required: RoleUser, want: true},
+		{role: RoleUser, required: RoleModerator, want: false},
+		{role: "superuser", required: RoleUser, want: false},
+		{role: RoleAdmin, required: "superuser", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.role+"/"+tt.required, func(t *testing.T) {
+			if got := HasRole(tt.role, tt.required); got != tt.want {
+				t.Errorf("HasRole(%q, %q) = %v, want %v", tt.role, tt.required, got, tt.want)
+			}
+		})
+	}
+}
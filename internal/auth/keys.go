@@ -0,0 +1,226 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// KeySet holds every key Chirpy tokens are signed or verified with. New tokens
+// are signed with the current asymmetric key; the others stay valid for
+// verification so tokens signed before a rotation keep working. The legacy
+// HS256 secret is only used to sign when no asymmetric key is configured.
+type KeySet struct {
+	current      string
+	keys         map[string]signingKey
+	legacySecret []byte
+}
+
+type signingKey struct {
+	method  jwt.SigningMethod
+	private crypto.Signer
+}
+
+func NewKeySet(legacySecret string) *KeySet {
+	return &KeySet{
+		keys: map[string]signingKey{},
+		legacySecret: []byte(legacySecret),
+	}
+}
+
+// AddKey registers an RSA or Ed25519 private key under kid. The first key
+// added becomes the signing key until SetCurrent picks another.
+func (ks *KeySet) AddKey(kid string, key crypto.PrivateKey) error {
+	if kid == "" {
+		return errors.New("Key ID is required")
+	}
+
+	var k signingKey
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		if key.N.BitLen() < 2048 {
+			return fmt.Errorf("RSA key %s is shorter than 2048 bits", kid)
+		}
+		k = signingKey{method: jwt.SigningMethodRS256, private: key}
+	case ed25519.PrivateKey:
+		k = signingKey{method: jwt.SigningMethodEdDSA, private: key}
+	default:
+		return fmt.Errorf("Unsupported key type %T for key %s", key, kid)
+	}
+
+	ks.keys[kid] = k
+	if ks.current == "" {
+		ks.current = kid
+	}
+	return nil
+}
+
+func (ks *KeySet) SetCurrent(kid string) error {
+	if _, ok := ks.keys[kid]; !ok {
+		return fmt.Errorf("Unknown key ID %s", kid)
+	}
+	ks.current = kid
+	return nil
+}
+
+// LoadKeySet reads every PEM encoded private key in dir, using the file name
+// without its .pem extension as the kid. currentKID picks the signing key;
+// when it's empty the last kid in sort order is used, so date-named keys
+// rotate by dropping in a new file.
+func LoadKeySet(dir, currentKID, legacySecret string) (*KeySet, error) {
+	ks := NewKeySet(legacySecret)
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := parsePrivateKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("Couldn't parse %s: %w", path, err)
+		}
+
+		kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+		if err := ks.AddKey(kid, key); err != nil {
+			return nil, err
+		}
+		ks.current = kid
+	}
+
+	if currentKID != "" {
+		if err := ks.SetCurrent(currentKID); err != nil {
+			return nil, err
+		}
+	}
+
+	if ks.current == "" && len(ks.legacySecret) == 0 {
+		return nil, errors.New("No signing keys or legacy secret configured")
+	}
+
+	return ks, nil
+}
+
+func parsePrivateKey(data []byte) (crypto.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("No PEM block found")
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	return nil, fmt.Errorf("Unsupported PEM block %s", block.Type)
+}
+
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	if ks.current == "" {
+		if len(ks.legacySecret) == 0 {
+			return "", errors.New("No signing key configured")
+		}
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(ks.legacySecret)
+	}
+
+	key := ks.keys[ks.current]
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = ks.current
+	return token.SignedString(key.private)
+}
+
+// keyFunc picks the verification key for a token from its kid. The algorithm
+// must match the key's, so a public key can never be used as an HMAC secret.
+func (ks *KeySet) keyFunc(token *jwt.Token) (any, error) {
+	if token.Method == jwt.SigningMethodHS256 {
+		if len(ks.legacySecret) == 0 {
+			return nil, errors.New("HS256 tokens are not accepted")
+		}
+		return ks.legacySecret, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("Unknown key ID %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("Key %s doesn't sign with %s", kid, token.Method.Alg())
+	}
+	return key.private.Public(), nil
+}
+
+func (ks *KeySet) validMethods() []string {
+	return []string{
+		jwt.SigningMethodRS256.Alg(),
+		jwt.SigningMethodEdDSA.Alg(),
+		jwt.SigningMethodHS256.Alg(),
+	}
+}
+
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public half of every asymmetric key, for services that
+// verify Chirpy tokens on their own. The legacy secret is never published.
+func (ks *KeySet) JWKS() JWKS {
+	kids := make([]string, 0, len(ks.keys))
+	for kid := range ks.keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	jwks := JWKS{Keys: []JWK{}}
+	for _, kid := range kids {
+		key := ks.keys[kid]
+		jwk := JWK{
+			KeyID: kid,
+			Use: "sig",
+			Algorithm: key.method.Alg(),
+		}
+
+		switch public := key.private.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	return jwks
+}
@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+	"github.com/airlangga-hub/chirpy-go/internal/database"
+	"github.com/google/uuid"
+)
+
+var ErrTokenRevoked = errors.New("Token has been revoked")
+
+// RevocationStore lets access tokens be invalidated before they expire,
+// either one at a time by jti or per user with a watermark: every token the
+// user was issued before the watermark is rejected.
+type RevocationStore interface {
+	RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error
+	IsTokenRevoked(ctx context.Context, jti string) (bool, error)
+	RevokeUserTokens(ctx context.Context, userID uuid.UUID, issuedBefore time.Time) error
+	UserTokensValidAfter(ctx context.Context, userID uuid.UUID) (time.Time, error)
+}
+
+// CheckRevocation returns ErrTokenRevoked if claims were revoked in store. A
+// nil store revokes nothing.
+func CheckRevocation(ctx context.Context, store RevocationStore, claims Claims) error {
+	if store == nil {
+		return nil
+	}
+
+	if claims.ID != "" {
+		revoked, err := store.IsTokenRevoked(ctx, claims.ID)
+		if err != nil {
+			return err
+		}
+		if revoked {
+			return ErrTokenRevoked
+		}
+	}
+
+	validAfter, err := store.UserTokensValidAfter(ctx, claims.UserID)
+	if err != nil {
+		return err
+	}
+	if claims.IssuedAt.Before(validAfter) {
+		return ErrTokenRevoked
+	}
+
+	return nil
+}
+
+// MemoryRevocationStore keeps revocations in process. It's only suitable for
+// a single instance and tests; revocations are lost on restart.
+type MemoryRevocationStore struct {
+	mu         sync.Mutex
+	tokens     map[string]time.Time
+	watermarks map[uuid.UUID]time.Time
+}
+
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		tokens: map[string]time.Time{},
+		watermarks: map[uuid.UUID]time.Time{},
+	}
+}
+
+func (s *MemoryRevocationStore) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for id, exp := range s.tokens {
+		if exp.Before(now) {
+			delete(s.tokens, id)
+		}
+	}
+
+	s.tokens[jti] = expiresAt
+	return nil
+}
+
+func (s *MemoryRevocationStore) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, revoked := s.tokens[jti]
+	return revoked, nil
+}
+
+func (s *MemoryRevocationStore) RevokeUserTokens(ctx context.Context, userID uuid.UUID, issuedBefore time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if issuedBefore.After(s.watermarks[userID]) {
+		s.watermarks[userID] = issuedBefore
+	}
+	return nil
+}
+
+func (s *MemoryRevocationStore) UserTokensValidAfter(ctx context.Context, userID uuid.UUID) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.watermarks[userID], nil
+}
+
+// PGRevocationStore keeps revoked jtis in revoked_tokens and the watermark in
+// users.tokens_valid_after, so every instance sees the same revocations.
+type PGRevocationStore struct {
+	db *database.Queries
+}
+
+func NewPGRevocationStore(db *database.Queries) *PGRevocationStore {
+	return &PGRevocationStore{db: db}
+}
+
+func (s *PGRevocationStore) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	if err := s.db.DeleteExpiredRevokedTokens(ctx); err != nil {
+		return err
+	}
+
+	return s.db.RevokeToken(ctx, database.RevokeTokenParams{
+		Jti: jti,
+		ExpiresAt: expiresAt.UTC(),
+	})
+}
+
+func (s *PGRevocationStore) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	return s.db.IsTokenRevoked(ctx, jti)
+}
+
+func (s *PGRevocationStore) RevokeUserTokens(ctx context.Context, userID uuid.UUID, issuedBefore time.Time) error {
+	return s.db.SetUserTokensValidAfter(ctx, database.SetUserTokensValidAfterParams{
+		TokensValidAfter: issuedBefore.UTC(),
+		ID: userID,
+	})
+}
+
+func (s *PGRevocationStore) UserTokensValidAfter(ctx context.Context, userID uuid.UUID) (time.Time, error) {
+	validAfter, err := s.db.GetUserTokensValidAfter(ctx, userID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return validAfter.Time, nil
+}
@@ -0,0 +1,32 @@
+package auth
+
+// Roles, from least to most trusted. Each role can do everything the ones
+// before it can.
+const (
+	RoleUser = "user"
+	RoleModerator = "moderator"
+	RoleAdmin = "admin"
+)
+
+var roleRanks = map[string]int{
+	RoleUser: 0,
+	RoleModerator: 1,
+	RoleAdmin: 2,
+}
+
+// ValidRole reports whether role is one of the known roles.
+func ValidRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+// HasRole reports whether someone with role may act as required. Unknown
+// roles are never enough.
+func HasRole(role, required string) bool {
+	rank, ok := roleRanks[role]
+	if !ok {
+		return false
+	}
+	requiredRank, ok := roleRanks[required]
+	return ok && rank >= requiredRank
+}
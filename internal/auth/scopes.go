@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	// ScopeAccount covers managing the account itself: password, email,
+	// two-factor, sessions and tokens. Only login sessions get it.
+	ScopeAccount = "account"
+	ScopeChirpsWrite = "chirps:write"
+	ScopeChirpsDelete = "chirps:delete"
+	ScopeProfileWrite = "profile:write"
+	ScopeMessagesRead = "messages:read"
+	ScopeMessagesWrite = "messages:write"
+	// ScopeAdmin lets a token reach the /admin routes at all; the user's
+	// role still decides which. Only login sessions get it.
+	ScopeAdmin = "admin"
+)
+
+// SessionScopes are granted to every token handed out by logging in.
+var SessionScopes = []string{
+	ScopeAccount,
+	ScopeChirpsWrite,
+	ScopeChirpsDelete,
+	ScopeProfileWrite,
+	ScopeMessagesRead,
+	ScopeMessagesWrite,
+	ScopeAdmin,
+}
+
+// DelegableScopes are the scopes a user may hand to a personal access token.
+var DelegableScopes = []string{
+	ScopeChirpsWrite,
+	ScopeChirpsDelete,
+	ScopeProfileWrite,
+	ScopeMessagesRead,
+	ScopeMessagesWrite,
+}
+
+func (c Claims) HasScope(scope string) bool {
+	return slices.Contains(c.Scopes, scope)
+}
+
+// ValidateScopes checks that scopes is non-empty and only asks for scopes in
+// allowed.
+func ValidateScopes(scopes, allowed []string) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("At least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(allowed, scope) {
+			return fmt.Errorf("Scope %q can't be granted", scope)
+		}
+	}
+	return nil
+}
+
+func formatScopes(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+func parseScopes(scope string) []string {
+	return strings.Fields(scope)
+}
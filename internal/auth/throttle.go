@@ -0,0 +1,84 @@
+package auth
+
+import "time"
+
+// LoginThrottle slows down password guessing. The first FreeAttempts
+// failures cost nothing; after that each failure doubles the wait before the
+// next attempt, from BaseDelay up to MaxDelay, and LockoutAfter failures lock
+// the key out for LockoutDuration. Counts start over after ResetAfter with no
+// failures.
+type LoginThrottle struct {
+	FreeAttempts    int
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	LockoutAfter    int
+	LockoutDuration time.Duration
+	ResetAfter      time.Duration
+}
+
+// AccountThrottle applies to each email address, whether or not an account
+// exists for it, so lockouts don't reveal which ones do.
+var AccountThrottle = LoginThrottle{
+	FreeAttempts: 3,
+	BaseDelay: time.Second,
+	MaxDelay: 5 * time.Minute,
+	LockoutAfter: 10,
+	LockoutDuration: 15 * time.Minute,
+	ResetAfter: 24 * time.Hour,
+}
+
+// IPThrottle applies to each client IP. It's looser than AccountThrottle
+// because many users can share an address behind NAT.
+var IPThrottle = LoginThrottle{
+	FreeAttempts: 20,
+	BaseDelay: time.Second,
+	MaxDelay: 5 * time.Minute,
+	LockoutAfter: 100,
+	LockoutDuration: time.Hour,
+	ResetAfter: time.Hour,
+}
+
+// MFAThrottle applies to each account's second factor. Unlike
+// AccountThrottle it isn't cleared by a correct password, so logging in
+// again for a fresh MFA token doesn't buy more guesses at the code.
+var MFAThrottle = LoginThrottle{
+	FreeAttempts: 3,
+	BaseDelay: time.Second,
+	MaxDelay: 5 * time.Minute,
+	LockoutAfter: 10,
+	LockoutDuration: 15 * time.Minute,
+	ResetAfter: 24 * time.Hour,
+}
+
+// MFATokenMaxFailures is how many wrong codes burn an MFA token.
+const MFATokenMaxFailures = 5
+
+// MFATokenThrottle applies to each MFA token. The lockout outlasts the
+// token, so after MFATokenMaxFailures wrong codes it can't be used again.
+var MFATokenThrottle = LoginThrottle{
+	FreeAttempts: MFATokenMaxFailures - 1,
+	LockoutAfter: MFATokenMaxFailures,
+	LockoutDuration: time.Hour,
+	ResetAfter: time.Hour,
+}
+
+// RetryAfter returns how long to wait before another attempt, given
+// failures so far and the time of the last one. Zero means try now.
+func (t LoginThrottle) RetryAfter(failures int, lastFailure, now time.Time) time.Duration {
+	if failures <= t.FreeAttempts || now.Sub(lastFailure) >= t.ResetAfter {
+		return 0
+	}
+
+	var wait time.Duration
+	if t.LockoutAfter > 0 && failures >= t.LockoutAfter {
+		wait = t.LockoutDuration
+	} else {
+		wait = t.BaseDelay
+		for i := t.FreeAttempts + 1; i < failures && wait < t.MaxDelay; i++ {
+			wait *= 2
+		}
+		wait = min(wait, t.MaxDelay)
+	}
+
+	return max(lastFailure.Add(wait).Sub(now), 0)
+}
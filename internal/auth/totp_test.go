@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+func TestGenerateTOTP(t *testing.T) {
+	// RFC 6238 appendix B SHA1 vectors, truncated to 6 digits
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		name     string
+		unixTime int64
+		wantCode string
+	}{
+		{name: "T=59", unixTime: 59, wantCode: "287082"},
+		{name: "T=1111111109", unixTime: 1111111109, wantCode: "081804"},
+		{name: "T=1234567890", unixTime: 1234567890, wantCode: "005924"},
+		{name: "T=20000000000", unixTime: 20000000000, wantCode: "353130"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GenerateTOTP(secret, TOTPStep(time.Unix(tt.unixTime, 0)))
+			if err != nil {
+				t.Fatalf("GenerateTOTP() error = %v", err)
+			}
+			if got != tt.wantCode {
+				t.Errorf("GenerateTOTP() = %v, want %v", got, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret := MakeTOTPSecret()
+	now := time.Now()
+	step := TOTPStep(now)
+
+	current, _ := GenerateTOTP(secret, step)
+	previous, _ := GenerateTOTP(secret, step-1)
+	stale, _ := GenerateTOTP(secret, step-5)
+
+	tests := []struct {
+		name     string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{name: "Current code", code: current, wantStep: step, wantOK: true},
+		{name: "Previous step within skew", code: previous, wantStep: step - 1, wantOK: true},
+		{name: "Stale code", code: stale, wantOK: false},
+		{name: "Wrong length", code: "12345", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStep, ok := ValidateTOTP(secret, tt.code, now)
+			if ok != tt.wantOK {
+				t.Fatalf("ValidateTOTP() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && gotStep != tt.wantStep {
+				t.Errorf("ValidateTOTP() step = %v, want %v", gotStep, tt.wantStep)
+			}
+		})
+	}
+}
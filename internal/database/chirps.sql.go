@@ -11,6 +11,19 @@ import (
 	"github.com/google/uuid"
 )
 
+const countChirpsByUser = `-- name: CountChirpsByUser :one
+SELECT COUNT(*)
+FROM chirps
+WHERE user_id = $1
+`
+
+func (q *Queries) CountChirpsByUser(ctx context.Context, userID uuid.UUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countChirpsByUser, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createChirp = `-- name: CreateChirp :one
 INSERT INTO chirps (
     id,
@@ -6,11 +6,44 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type ApiKey struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UserID     uuid.UUID
+	Name       string
+	KeyHash    string
+	KeyPrefix  string
+	Scopes     []string
+	ExpiresAt  sql.NullTime
+	LastUsedAt sql.NullTime
+	RevokedAt  sql.NullTime
+}
+
+type AuditEvent struct {
+	ID             uuid.UUID
+	CreatedAt      time.Time
+	ActorID        uuid.NullUUID
+	Action         string
+	TargetUserID   uuid.NullUUID
+	IpAddress      string
+	UserAgent      string
+	Details        json.RawMessage
+	Diff           json.RawMessage
+	ImpersonatorID uuid.NullUUID
+}
+
+type Block struct {
+	BlockerID uuid.UUID
+	BlockedID uuid.UUID
+	CreatedAt time.Time
+}
+
 type Chirp struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
@@ -19,20 +52,177 @@ type Chirp struct {
 	UserID    uuid.UUID
 }
 
-type RefreshToken struct {
-	Token     string
+type Conversation struct {
+	ID        uuid.UUID
 	CreatedAt time.Time
 	UpdatedAt time.Time
+}
+
+type ConversationMember struct {
+	ConversationID uuid.UUID
+	UserID         uuid.UUID
+	JoinedAt       time.Time
+	LastReadAt     sql.NullTime
+}
+
+type DirectConversation struct {
+	UserAID        uuid.UUID
+	UserBID        uuid.UUID
+	ConversationID uuid.UUID
+}
+
+type EmailVerificationToken struct {
+	TokenHash string
+	CreatedAt time.Time
 	UserID    uuid.UUID
+	Email     string
 	ExpiresAt time.Time
-	RevokedAt sql.NullTime
+	UsedAt    sql.NullTime
 }
 
-type User struct {
+type EventPayload struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	Payload   string
+}
+
+type Follow struct {
+	FollowerID uuid.UUID
+	FollowedID uuid.UUID
+	CreatedAt  time.Time
+}
+
+type LoginFailure struct {
+	Key            string
+	Failures       int32
+	FirstFailureAt time.Time
+	LastFailureAt  time.Time
+}
+
+type MagicLinkToken struct {
+	TokenHash   string
+	CreatedAt   time.Time
+	UserID      uuid.UUID
+	BrowserHash string
+	ExpiresAt   time.Time
+	UsedAt      sql.NullTime
+}
+
+type Message struct {
 	ID             uuid.UUID
 	CreatedAt      time.Time
-	UpdatedAt      time.Time
-	Email          string
-	HashedPassword string
-	IsChirpyRed    bool
+	ConversationID uuid.UUID
+	SenderID       uuid.UUID
+	Body           string
+}
+
+type MfaRecoveryCode struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	CodeHash  string
+	UsedAt    sql.NullTime
+}
+
+type OauthAuthorizationCode struct {
+	CodeHash      string
+	CreatedAt     time.Time
+	ClientID      uuid.UUID
+	UserID        uuid.UUID
+	RedirectUri   string
+	Scopes        []string
+	CodeChallenge string
+	ExpiresAt     time.Time
+	UsedAt        sql.NullTime
+}
+
+type OauthClient struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	OwnerID      uuid.UUID
+	Name         string
+	SecretHash   sql.NullString
+	RedirectUris []string
+}
+
+type OidcLoginState struct {
+	StateHash    string
+	CreatedAt    time.Time
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	ExpiresAt    time.Time
+}
+
+type PasswordResetToken struct {
+	TokenHash string
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type PersonalAccessToken struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	Name      string
+	Scopes    []string
+	ExpiresAt time.Time
+	RevokedAt sql.NullTime
+}
+
+type RefreshToken struct {
+	TokenHash  string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	UserID     uuid.UUID
+	ExpiresAt  time.Time
+	RevokedAt  sql.NullTime
+	FamilyID   uuid.UUID
+	RotatedAt  sql.NullTime
+	UserAgent  string
+	IpAddress  string
+	LastUsedAt time.Time
+	ClientID   uuid.NullUUID
+	Scopes     []string
+}
+
+type RevokedToken struct {
+	Jti       string
+	ExpiresAt time.Time
+}
+
+type User struct {
+	ID               uuid.UUID
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	Email            string
+	HashedPassword   string
+	IsChirpyRed      bool
+	Handle           string
+	DisplayName      string
+	Bio              string
+	Location         string
+	Website          string
+	AvatarKey        string
+	BannerKey        string
+	EmailVerifiedAt  sql.NullTime
+	PendingEmail     sql.NullString
+	TotpSecret       sql.NullString
+	TotpEnabledAt    sql.NullTime
+	TotpLastStep     int64
+	TokensValidAfter sql.NullTime
+	Role             string
+	DmPolicy         string
+}
+
+type UserIdentity struct {
+	Provider    string
+	Subject     string
+	CreatedAt   time.Time
+	UserID      uuid.UUID
+	Email       string
+	LastLoginAt time.Time
 }
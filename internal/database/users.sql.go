@@ -7,35 +7,87 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
 )
 
+const countPasswordHashesByParams = `-- name: CountPasswordHashesByParams :many
+SELECT split_part(hashed_password, '$', 4) AS params, COUNT(*) AS users
+FROM users
+GROUP BY params
+ORDER BY users DESC
+`
+
+type CountPasswordHashesByParamsRow struct {
+	Params string
+	Users  int64
+}
+
+func (q *Queries) CountPasswordHashesByParams(ctx context.Context) ([]CountPasswordHashesByParamsRow, error) {
+	rows, err := q.db.QueryContext(ctx, countPasswordHashesByParams)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []CountPasswordHashesByParamsRow
+	for rows.Next() {
+		var i CountPasswordHashesByParamsRow
+		if err := rows.Scan(&i.Params, &i.Users); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const countUsersWithRole = `-- name: CountUsersWithRole :one
+SELECT COUNT(*) FROM users
+WHERE role = $1
+`
+
+func (q *Queries) CountUsersWithRole(ctx context.Context, role string) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countUsersWithRole, role)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (
     id,
     created_at,
     updated_at,
     email,
-    hashed_password
+    hashed_password,
+    handle
 )
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    $3
 )
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, display_name, bio, location, website, avatar_key, banner_key, email_verified_at, pending_email, totp_secret, totp_enabled_at, totp_last_step, tokens_valid_after, role, dm_policy
 `
 
 type CreateUserParams struct {
 	Email          string
 	HashedPassword string
+	Handle         string
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
-	row := q.db.QueryRowContext(ctx, createUser, arg.Email, arg.HashedPassword)
+	row := q.db.QueryRowContext(ctx, createUser, arg.Email, arg.HashedPassword, arg.Handle)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -44,12 +96,75 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.Location,
+		&i.Website,
+		&i.AvatarKey,
+		&i.BannerKey,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.TokensValidAfter,
+		&i.Role,
+		&i.DmPolicy,
+	)
+	return i, err
+}
+
+const deleteUser = `-- name: DeleteUser :execrows
+DELETE FROM users
+WHERE id = $1
+`
+
+func (q *Queries) DeleteUser(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteUser, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getUser = `-- name: GetUser :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, display_name, bio, location, website, avatar_key, banner_key, email_verified_at, pending_email, totp_secret, totp_enabled_at, totp_last_step, tokens_valid_after, role, dm_policy
+FROM users
+WHERE id = $1
+`
+
+func (q *Queries) GetUser(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUser, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.Location,
+		&i.Website,
+		&i.AvatarKey,
+		&i.BannerKey,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.TokensValidAfter,
+		&i.Role,
+		&i.DmPolicy,
 	)
 	return i, err
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, display_name, bio, location, website, avatar_key, banner_key, email_verified_at, pending_email, totp_secret, totp_enabled_at, totp_last_step, tokens_valid_after, role, dm_policy
 FROM users
 WHERE email = $1
 `
@@ -64,25 +179,320 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.Location,
+		&i.Website,
+		&i.AvatarKey,
+		&i.BannerKey,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.TokensValidAfter,
+		&i.Role,
+		&i.DmPolicy,
+	)
+	return i, err
+}
+
+const getUserByHandle = `-- name: GetUserByHandle :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, display_name, bio, location, website, avatar_key, banner_key, email_verified_at, pending_email, totp_secret, totp_enabled_at, totp_last_step, tokens_valid_after, role, dm_policy
+FROM users
+WHERE LOWER(handle) = LOWER($1)
+`
+
+func (q *Queries) GetUserByHandle(ctx context.Context, handle string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByHandle, handle)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.Location,
+		&i.Website,
+		&i.AvatarKey,
+		&i.BannerKey,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.TokensValidAfter,
+		&i.Role,
+		&i.DmPolicy,
 	)
 	return i, err
 }
 
+const getUserTokensValidAfter = `-- name: GetUserTokensValidAfter :one
+SELECT tokens_valid_after FROM users
+WHERE id = $1
+`
+
+func (q *Queries) GetUserTokensValidAfter(ctx context.Context, id uuid.UUID) (sql.NullTime, error) {
+	row := q.db.QueryRowContext(ctx, getUserTokensValidAfter, id)
+	var tokens_valid_after sql.NullTime
+	err := row.Scan(&tokens_valid_after)
+	return tokens_valid_after, err
+}
+
+const rehashUserPassword = `-- name: RehashUserPassword :exec
+UPDATE users
+SET hashed_password = $1
+WHERE id = $2
+AND hashed_password = $3
+`
+
+type RehashUserPasswordParams struct {
+	NewHash string
+	ID      uuid.UUID
+	OldHash string
+}
+
+func (q *Queries) RehashUserPassword(ctx context.Context, arg RehashUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, rehashUserPassword, arg.NewHash, arg.ID, arg.OldHash)
+	return err
+}
+
+const searchUsers = `-- name: SearchUsers :many
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, display_name, bio, location, website, avatar_key, banner_key, email_verified_at, pending_email, totp_secret, totp_enabled_at, totp_last_step, tokens_valid_after, role, dm_policy FROM users
+WHERE email ILIKE $1
+OR handle ILIKE $1
+ORDER BY created_at DESC
+LIMIT $2
+`
+
+type SearchUsersParams struct {
+	Pattern    string
+	MaxResults int32
+}
+
+func (q *Queries) SearchUsers(ctx context.Context, arg SearchUsersParams) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, searchUsers, arg.Pattern, arg.MaxResults)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Email,
+			&i.HashedPassword,
+			&i.IsChirpyRed,
+			&i.Handle,
+			&i.DisplayName,
+			&i.Bio,
+			&i.Location,
+			&i.Website,
+			&i.AvatarKey,
+			&i.BannerKey,
+			&i.EmailVerifiedAt,
+			&i.PendingEmail,
+			&i.TotpSecret,
+			&i.TotpEnabledAt,
+			&i.TotpLastStep,
+			&i.TokensValidAfter,
+			&i.Role,
+			&i.DmPolicy,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setUserChirpyRed = `-- name: SetUserChirpyRed :one
+UPDATE users
+SET is_chirpy_red = $1, updated_at = NOW()
+WHERE id = $2
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, display_name, bio, location, website, avatar_key, banner_key, email_verified_at, pending_email, totp_secret, totp_enabled_at, totp_last_step, tokens_valid_after, role, dm_policy
+`
+
+type SetUserChirpyRedParams struct {
+	IsChirpyRed bool
+	ID          uuid.UUID
+}
+
+func (q *Queries) SetUserChirpyRed(ctx context.Context, arg SetUserChirpyRedParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserChirpyRed, arg.IsChirpyRed, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.Location,
+		&i.Website,
+		&i.AvatarKey,
+		&i.BannerKey,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.TokensValidAfter,
+		&i.Role,
+		&i.DmPolicy,
+	)
+	return i, err
+}
+
+const setUserPendingEmail = `-- name: SetUserPendingEmail :one
+UPDATE users
+SET pending_email = $1, updated_at = NOW()
+WHERE id = $2
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, display_name, bio, location, website, avatar_key, banner_key, email_verified_at, pending_email, totp_secret, totp_enabled_at, totp_last_step, tokens_valid_after, role, dm_policy
+`
+
+type SetUserPendingEmailParams struct {
+	PendingEmail sql.NullString
+	ID           uuid.UUID
+}
+
+func (q *Queries) SetUserPendingEmail(ctx context.Context, arg SetUserPendingEmailParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserPendingEmail, arg.PendingEmail, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.Location,
+		&i.Website,
+		&i.AvatarKey,
+		&i.BannerKey,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.TokensValidAfter,
+		&i.Role,
+		&i.DmPolicy,
+	)
+	return i, err
+}
+
+const setUserRole = `-- name: SetUserRole :one
+UPDATE users
+SET role = $1, updated_at = NOW()
+WHERE id = $2
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, display_name, bio, location, website, avatar_key, banner_key, email_verified_at, pending_email, totp_secret, totp_enabled_at, totp_last_step, tokens_valid_after, role, dm_policy
+`
+
+type SetUserRoleParams struct {
+	Role string
+	ID   uuid.UUID
+}
+
+func (q *Queries) SetUserRole(ctx context.Context, arg SetUserRoleParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserRole, arg.Role, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.Location,
+		&i.Website,
+		&i.AvatarKey,
+		&i.BannerKey,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.TokensValidAfter,
+		&i.Role,
+		&i.DmPolicy,
+	)
+	return i, err
+}
+
+const setUserTokensValidAfter = `-- name: SetUserTokensValidAfter :exec
+UPDATE users
+SET tokens_valid_after = GREATEST(tokens_valid_after, $1::timestamp), updated_at = NOW()
+WHERE id = $2
+`
+
+type SetUserTokensValidAfterParams struct {
+	TokensValidAfter time.Time
+	ID               uuid.UUID
+}
+
+func (q *Queries) SetUserTokensValidAfter(ctx context.Context, arg SetUserTokensValidAfterParams) error {
+	_, err := q.db.ExecContext(ctx, setUserTokensValidAfter, arg.TokensValidAfter, arg.ID)
+	return err
+}
+
 const updateUser = `-- name: UpdateUser :one
 UPDATE users
-SET email = $1, hashed_password = $2, updated_at = NOW()
-WHERE id = $3
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+SET handle = $1,
+    display_name = $2,
+    bio = $3,
+    location = $4,
+    website = $5,
+    dm_policy = $6,
+    updated_at = NOW()
+WHERE id = $7
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, display_name, bio, location, website, avatar_key, banner_key, email_verified_at, pending_email, totp_secret, totp_enabled_at, totp_last_step, tokens_valid_after, role, dm_policy
 `
 
 type UpdateUserParams struct {
-	Email          string
-	HashedPassword string
-	ID             uuid.UUID
+	Handle      string
+	DisplayName string
+	Bio         string
+	Location    string
+	Website     string
+	DmPolicy    string
+	ID          uuid.UUID
 }
 
 func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error) {
-	row := q.db.QueryRowContext(ctx, updateUser, arg.Email, arg.HashedPassword, arg.ID)
+	row := q.db.QueryRowContext(ctx, updateUser,
+		arg.Handle,
+		arg.DisplayName,
+		arg.Bio,
+		arg.Location,
+		arg.Website,
+		arg.DmPolicy,
+		arg.ID,
+	)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -91,17 +501,164 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.Location,
+		&i.Website,
+		&i.AvatarKey,
+		&i.BannerKey,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.TokensValidAfter,
+		&i.Role,
+		&i.DmPolicy,
 	)
 	return i, err
 }
 
-const updateUserChirpyRed = `-- name: UpdateUserChirpyRed :exec
+const updateUserAvatar = `-- name: UpdateUserAvatar :one
 UPDATE users
-SET is_chirpy_red = true, updated_at = NOW()
-WHERE id = $1
+SET avatar_key = $1, updated_at = NOW()
+WHERE id = $2
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, display_name, bio, location, website, avatar_key, banner_key, email_verified_at, pending_email, totp_secret, totp_enabled_at, totp_last_step, tokens_valid_after, role, dm_policy
+`
+
+type UpdateUserAvatarParams struct {
+	AvatarKey string
+	ID        uuid.UUID
+}
+
+func (q *Queries) UpdateUserAvatar(ctx context.Context, arg UpdateUserAvatarParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserAvatar, arg.AvatarKey, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.Location,
+		&i.Website,
+		&i.AvatarKey,
+		&i.BannerKey,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.TokensValidAfter,
+		&i.Role,
+		&i.DmPolicy,
+	)
+	return i, err
+}
+
+const updateUserBanner = `-- name: UpdateUserBanner :one
+UPDATE users
+SET banner_key = $1, updated_at = NOW()
+WHERE id = $2
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, display_name, bio, location, website, avatar_key, banner_key, email_verified_at, pending_email, totp_secret, totp_enabled_at, totp_last_step, tokens_valid_after, role, dm_policy
+`
+
+type UpdateUserBannerParams struct {
+	BannerKey string
+	ID        uuid.UUID
+}
+
+func (q *Queries) UpdateUserBanner(ctx context.Context, arg UpdateUserBannerParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserBanner, arg.BannerKey, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.Location,
+		&i.Website,
+		&i.AvatarKey,
+		&i.BannerKey,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.TokensValidAfter,
+		&i.Role,
+		&i.DmPolicy,
+	)
+	return i, err
+}
+
+const updateUserPassword = `-- name: UpdateUserPassword :exec
+UPDATE users
+SET hashed_password = $1, updated_at = NOW()
+WHERE id = $2
 `
 
-func (q *Queries) UpdateUserChirpyRed(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.ExecContext(ctx, updateUserChirpyRed, id)
+type UpdateUserPasswordParams struct {
+	HashedPassword string
+	ID             uuid.UUID
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserPassword, arg.HashedPassword, arg.ID)
 	return err
 }
+
+const verifyUserEmail = `-- name: VerifyUserEmail :one
+UPDATE users
+SET email = $1,
+    pending_email = NULL,
+    email_verified_at = NOW(),
+    updated_at = NOW()
+WHERE id = $2
+AND (email = $1 OR pending_email = $1)
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, display_name, bio, location, website, avatar_key, banner_key, email_verified_at, pending_email, totp_secret, totp_enabled_at, totp_last_step, tokens_valid_after, role, dm_policy
+`
+
+type VerifyUserEmailParams struct {
+	Email string
+	ID    uuid.UUID
+}
+
+func (q *Queries) VerifyUserEmail(ctx context.Context, arg VerifyUserEmailParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, verifyUserEmail, arg.Email, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.Location,
+		&i.Website,
+		&i.AvatarKey,
+		&i.BannerKey,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.TokensValidAfter,
+		&i.Role,
+		&i.DmPolicy,
+	)
+	return i, err
+}
@@ -0,0 +1,118 @@
+package imaging
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"io"
+
+	_ "image/gif"
+	_ "image/png"
+)
+
+const jpegQuality = 85
+
+const MaxPixels = 40_000_000
+
+var ErrTooLarge = errors.New("Image dimensions too large")
+
+// Decode reads a JPEG, PNG or GIF, refusing images whose pixel count would
+// make decoding a memory hazard.
+func Decode(r io.ReadSeeker) (image.Image, string, error) {
+	config, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil, "", err
+	}
+	if config.Width*config.Height > MaxPixels {
+		return nil, "", ErrTooLarge
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, "", err
+	}
+
+	return image.Decode(r)
+}
+
+// CropToAspect returns the largest centered region of img with the ratio
+// width:height.
+func CropToAspect(img image.Image, width, height int) image.Image {
+	bounds := img.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+
+	cropW, cropH := srcW, srcW*height/width
+	if cropH > srcH {
+		cropW, cropH = srcH*width/height, srcH
+	}
+	// A sliver like 1x3 cropped to 3:1 would round down to nothing.
+	cropW, cropH = max(cropW, 1), max(cropH, 1)
+
+	x0 := bounds.Min.X + (srcW-cropW)/2
+	y0 := bounds.Min.Y + (srcH-cropH)/2
+	rect := image.Rect(x0, y0, x0+cropW, y0+cropH)
+
+	dst := image.NewRGBA(image.Rect(0, 0, cropW, cropH))
+	draw.Draw(dst, dst.Bounds(), img, rect.Min, draw.Src)
+	return dst
+}
+
+// Resize scales img to exactly width x height. Each output pixel is the
+// average of the source pixels it covers, which keeps downscaled photos
+// smooth; upscaling falls back to the nearest source pixel.
+func Resize(img image.Image, width, height int) *image.RGBA {
+	src := toRGBA(img)
+	bounds := src.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		sy0 := y * srcH / height
+		sy1 := max((y+1)*srcH/height, sy0+1)
+
+		for x := 0; x < width; x++ {
+			sx0 := x * srcW / width
+			sx1 := max((x+1)*srcW/width, sx0+1)
+
+			var r, g, b, a, n uint32
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					c := src.RGBAAt(bounds.Min.X+sx, bounds.Min.Y+sy)
+					r += uint32(c.R)
+					g += uint32(c.G)
+					b += uint32(c.B)
+					a += uint32(c.A)
+					n++
+				}
+			}
+
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8(r / n),
+				G: uint8(g / n),
+				B: uint8(b / n),
+				A: uint8(a / n),
+			})
+		}
+	}
+
+	return dst
+}
+
+// EncodeJPEG flattens transparency onto white, since JPEG has no alpha.
+func EncodeJPEG(w io.Writer, img image.Image) error {
+	flat := image.NewRGBA(img.Bounds())
+	draw.Draw(flat, flat.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), img, img.Bounds().Min, draw.Over)
+	return jpeg.Encode(w, flat, &jpeg.Options{Quality: jpegQuality})
+}
+
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok {
+		return rgba
+	}
+	rgba := image.NewRGBA(img.Bounds())
+	draw.Draw(rgba, rgba.Bounds(), img, img.Bounds().Min, draw.Src)
+	return rgba
+}
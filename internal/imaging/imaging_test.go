@@ -0,0 +1,89 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestCropToAspect(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    image.Rectangle
+		width  int
+		height int
+		wantW  int
+		wantH  int
+	}{
+		{
+			name:   "Landscape to square",
+			src:    image.Rect(0, 0, 300, 200),
+			width:  1,
+			height: 1,
+			wantW:  200,
+			wantH:  200,
+		},
+		{
+			name:   "Portrait to square",
+			src:    image.Rect(0, 0, 200, 300),
+			width:  1,
+			height: 1,
+			wantW:  200,
+			wantH:  200,
+		},
+		{
+			name:   "Square to banner",
+			src:    image.Rect(0, 0, 600, 600),
+			width:  3,
+			height: 1,
+			wantW:  600,
+			wantH:  200,
+		},
+		{
+			name:   "Sliver to banner",
+			src:    image.Rect(0, 0, 1, 3),
+			width:  3,
+			height: 1,
+			wantW:  1,
+			wantH:  1,
+		},
+		{
+			name:   "Sliver to portrait",
+			src:    image.Rect(0, 0, 5, 1),
+			width:  1,
+			height: 3,
+			wantW:  1,
+			wantH:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CropToAspect(image.NewRGBA(tt.src), tt.width, tt.height).Bounds()
+			if got.Dx() != tt.wantW || got.Dy() != tt.wantH {
+				t.Errorf("CropToAspect() = %dx%d, want %dx%d", got.Dx(), got.Dy(), tt.wantW, tt.wantH)
+			}
+		})
+	}
+}
+
+func TestResize(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for y := 0; y < 2; y++ {
+		src.SetRGBA(0, y, color.RGBA{R: 255, A: 255})
+		src.SetRGBA(1, y, color.RGBA{R: 255, A: 255})
+		src.SetRGBA(2, y, color.RGBA{B: 255, A: 255})
+		src.SetRGBA(3, y, color.RGBA{B: 255, A: 255})
+	}
+
+	dst := Resize(src, 2, 1)
+	if dst.Bounds().Dx() != 2 || dst.Bounds().Dy() != 1 {
+		t.Fatalf("Resize() bounds = %v, want 2x1", dst.Bounds())
+	}
+	if got := dst.RGBAAt(0, 0); got != (color.RGBA{R: 255, A: 255}) {
+		t.Errorf("Resize() left pixel = %v, want red", got)
+	}
+	if got := dst.RGBAAt(1, 0); got != (color.RGBA{B: 255, A: 255}) {
+		t.Errorf("Resize() right pixel = %v, want blue", got)
+	}
+}
@@ -0,0 +1,120 @@
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeSMTPServer accepts a single message, like a tiny MailHog, and sends
+// the DATA section on the returned channel.
+func fakeSMTPServer(t *testing.T) (string, <-chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan string, 1)
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+		reply("220 localhost ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.TrimSpace(line))
+
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(cmd, "MAIL FROM"), strings.HasPrefix(cmd, "RCPT TO"):
+				reply("250 OK")
+			case cmd == "DATA":
+				reply("354 Send data")
+				var data strings.Builder
+				for {
+					dataLine, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if dataLine == ".\r\n" {
+						break
+					}
+					data.WriteString(dataLine)
+				}
+				received <- data.String()
+				reply("250 OK")
+			case cmd == "QUIT":
+				reply("221 Bye")
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+
+	return listener.Addr().String(), received
+}
+
+func TestSMTPMailer(t *testing.T) {
+	addr, received := fakeSMTPServer(t)
+
+	m := &SMTPMailer{Addr: addr, From: "chirpy@example.com"}
+	err := m.Send(context.Background(), Message{
+		To:      "user@example.com",
+		Subject: "Verify your email",
+		Body:    "Your token is abc123",
+	})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	data := <-received
+	for _, want := range []string{"To: user@example.com", "Subject: Verify your email", "Your token is abc123"} {
+		if !strings.Contains(data, want) {
+			t.Errorf("Send() message missing %q:\n%s", want, data)
+		}
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+
+	m := &FileMailer{Dir: dir, From: "chirpy@example.com"}
+	if err := m.Send(context.Background(), Message{To: "user@example.com", Subject: "Hi", Body: "Hello"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("Send() wrote %d files, want 1", len(files))
+	}
+
+	data, _ := os.ReadFile(files[0])
+	if !strings.Contains(string(data), "To: user@example.com") {
+		t.Errorf("Send() file missing recipient:\n%s", data)
+	}
+}
+
+func TestHeaderInjection(t *testing.T) {
+	m := &FileMailer{Dir: t.TempDir()}
+	err := m.Send(context.Background(), Message{To: "user@example.com\r\nBcc: evil@example.com", Subject: "Hi"})
+	if err == nil {
+		t.Error("Send() expected error for header injection")
+	}
+}
@@ -0,0 +1,280 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+	"github.com/airlangga-hub/chirpy-go/internal/auth"
+	"github.com/google/uuid"
+)
+
+const defaultCodeTTL = 10 * time.Minute
+
+// ErrInvalidGrant is returned by a TokenIssuer for refresh tokens that are
+// unknown, expired, revoked or belong to another client.
+var ErrInvalidGrant = errors.New("Invalid grant")
+
+// Client is a third-party app registered to act on behalf of Chirpy users.
+// Public clients, like mobile and single-page apps, can't keep a secret and
+// have no SecretHash; PKCE alone protects their codes.
+type Client struct {
+	ID           uuid.UUID
+	Name         string
+	SecretHash   string
+	RedirectURIs []string
+}
+
+func (c Client) Public() bool {
+	return c.SecretHash == ""
+}
+
+type AuthorizationCode struct {
+	CodeHash      string
+	ClientID      uuid.UUID
+	UserID        uuid.UUID
+	RedirectURI   string
+	Scopes        []string
+	CodeChallenge string
+	ExpiresAt     time.Time
+}
+
+type Tokens struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    time.Duration
+	Scopes       []string
+}
+
+// TokenIssuer mints and revokes the tokens handed to clients, so they come
+// from the same machinery as the ones users get by logging in. r is the
+// client's token request.
+type TokenIssuer interface {
+	IssueTokens(r *http.Request, clientID, userID uuid.UUID, scopes []string) (Tokens, error)
+	RefreshTokens(r *http.Request, clientID uuid.UUID, refreshToken string) (Tokens, error)
+	// RevokeToken revokes an access or refresh token issued to the client.
+	// Tokens it doesn't recognise are ignored.
+	RevokeToken(r *http.Request, clientID uuid.UUID, token string) error
+}
+
+// Error is an OAuth error response, RFC 6749 section 5.2.
+type Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+	status      int
+	redirectURI string
+	state       string
+	basic       bool
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Description)
+}
+
+// RedirectURL is where an authorization error should be sent, or "" if the
+// client or redirect URI couldn't be trusted and the error must be shown to
+// the user instead.
+func (e *Error) RedirectURL() string {
+	if e.redirectURI == "" {
+		return ""
+	}
+	params := url.Values{"error": {e.Code}}
+	if e.Description != "" {
+		params.Set("error_description", e.Description)
+	}
+	if e.state != "" {
+		params.Set("state", e.state)
+	}
+	return addQuery(e.redirectURI, params)
+}
+
+func newError(status int, code, description string) *Error {
+	return &Error{Code: code, Description: description, status: status}
+}
+
+// Server implements the authorization code flow with PKCE. Showing the
+// consent screen is left to the caller: ValidateAuthorize checks a request
+// and Approve or Deny answer it once the signed in user has decided.
+type Server struct {
+	store   Store
+	issuer  TokenIssuer
+	scopes  []string
+	codeTTL time.Duration
+}
+
+// NewServer creates a Server that lets clients ask for any of scopes.
+func NewServer(store Store, issuer TokenIssuer, scopes []string) *Server {
+	return &Server{
+		store: store,
+		issuer: issuer,
+		scopes: scopes,
+		codeTTL: defaultCodeTTL,
+	}
+}
+
+type AuthorizeRequest struct {
+	ResponseType        string `json:"response_type"`
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+}
+
+func AuthorizeRequestFromQuery(query url.Values) AuthorizeRequest {
+	return AuthorizeRequest{
+		ResponseType: query.Get("response_type"),
+		ClientID: query.Get("client_id"),
+		RedirectURI: query.Get("redirect_uri"),
+		Scope: query.Get("scope"),
+		State: query.Get("state"),
+		CodeChallenge: query.Get("code_challenge"),
+		CodeChallengeMethod: query.Get("code_challenge_method"),
+	}
+}
+
+// Consent is a validated authorization request: what the user is asked to
+// approve.
+type Consent struct {
+	Client        Client
+	RedirectURI   string
+	Scopes        []string
+	State         string
+	codeChallenge string
+}
+
+// ValidateAuthorize checks an authorization request. Errors are *Error.
+func (s *Server) ValidateAuthorize(ctx context.Context, req AuthorizeRequest) (Consent, error) {
+	clientID, err := uuid.Parse(req.ClientID)
+	if err != nil {
+		return Consent{}, newError(400, "invalid_request", "Invalid client_id")
+	}
+
+	client, err := s.store.GetClient(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return Consent{}, newError(400, "invalid_request", "Unknown client")
+		}
+		return Consent{}, err
+	}
+
+	redirectURI := req.RedirectURI
+	if redirectURI == "" && len(client.RedirectURIs) == 1 {
+		redirectURI = client.RedirectURIs[0]
+	}
+	if !slices.Contains(client.RedirectURIs, redirectURI) {
+		return Consent{}, newError(400, "invalid_request", "redirect_uri isn't registered for this client")
+	}
+
+	// From here on the redirect URI is trusted, so errors go back to the
+	// client rather than to the user.
+	fail := func(code, description string) (Consent, error) {
+		e := newError(400, code, description)
+		e.redirectURI = redirectURI
+		e.state = req.State
+		return Consent{}, e
+	}
+
+	if req.ResponseType != "code" {
+		return fail("unsupported_response_type", "Only the code response type is supported")
+	}
+	if req.CodeChallengeMethod != ChallengeMethodS256 {
+		return fail("invalid_request", "code_challenge_method must be S256")
+	}
+	if !validChallenge(req.CodeChallenge) {
+		return fail("invalid_request", "Invalid code_challenge")
+	}
+
+	scopes := strings.Fields(req.Scope)
+	slices.Sort(scopes)
+	scopes = slices.Compact(scopes)
+	if err := auth.ValidateScopes(scopes, s.scopes); err != nil {
+		return fail("invalid_scope", err.Error())
+	}
+
+	return Consent{
+		Client: client,
+		RedirectURI: redirectURI,
+		Scopes: scopes,
+		State: req.State,
+		codeChallenge: req.CodeChallenge,
+	}, nil
+}
+
+// Approve issues userID's authorization code for consent and returns the URL
+// to send the user's browser back to the client with.
+func (s *Server) Approve(ctx context.Context, userID uuid.UUID, consent Consent) (string, error) {
+	code := auth.MakeRefreshToken()
+
+	if err := s.store.CreateAuthorizationCode(ctx, AuthorizationCode{
+		CodeHash: auth.HashToken(code),
+		ClientID: consent.Client.ID,
+		UserID: userID,
+		RedirectURI: consent.RedirectURI,
+		Scopes: consent.Scopes,
+		CodeChallenge: consent.codeChallenge,
+		ExpiresAt: time.Now().UTC().Add(s.codeTTL),
+	}); err != nil {
+		return "", err
+	}
+
+	params := url.Values{"code": {code}}
+	if consent.State != "" {
+		params.Set("state", consent.State)
+	}
+	return addQuery(consent.RedirectURI, params), nil
+}
+
+// Deny returns the URL that tells the client the user refused.
+func (s *Server) Deny(consent Consent) string {
+	e := newError(400, "access_denied", "The user denied the request")
+	e.redirectURI = consent.RedirectURI
+	e.state = consent.State
+	return e.RedirectURL()
+}
+
+// ValidateRedirectURI checks a redirect URI a client wants to register. It
+// must be absolute without a fragment, and either https, http on a loopback
+// address for local development, or a private-use scheme like
+// com.example.app for native apps.
+func ValidateRedirectURI(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || !u.IsAbs() {
+		return fmt.Errorf("Redirect URI %q must be an absolute URL", raw)
+	}
+	if u.Fragment != "" || strings.Contains(raw, "#") {
+		return fmt.Errorf("Redirect URI %q must not have a fragment", raw)
+	}
+
+	switch {
+	case u.Scheme == "https" && u.Host != "":
+		return nil
+	case u.Scheme == "http" && isLoopback(u.Hostname()):
+		return nil
+	case strings.Contains(u.Scheme, "."):
+		return nil
+	}
+	return fmt.Errorf("Redirect URI %q must use https", raw)
+}
+
+func isLoopback(host string) bool {
+	return host == "localhost" || host == "127.0.0.1" || host == "::1"
+}
+
+func addQuery(rawURL string, params url.Values) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
@@ -0,0 +1,445 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"github.com/airlangga-hub/chirpy-go/internal/auth"
+	"github.com/google/uuid"
+)
+
+func TestVerifyPKCE(t *testing.T) {
+	// RFC 7636 appendix B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	tests := []struct {
+		name     string
+		verifier string
+		want     bool
+	}{
+		{name: "Matching verifier", verifier: verifier, want: true},
+		{name: "Different verifier", verifier: strings.Repeat("a", 43), want: false},
+		{name: "Too short", verifier: "short", want: false},
+		{name: "Invalid characters", verifier: strings.Repeat("a", 42) + "!", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifyPKCE(tt.verifier, challenge); got != tt.want {
+				t.Errorf("VerifyPKCE() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if got := ChallengeS256(verifier); got != challenge {
+		t.Errorf("ChallengeS256() = %v, want %v", got, challenge)
+	}
+}
+
+func TestValidateRedirectURI(t *testing.T) {
+	tests := []struct {
+		name    string
+		uri     string
+		wantErr bool
+	}{
+		{name: "https", uri: "https://app.example.com/callback", wantErr: false},
+		{name: "Loopback http", uri: "http://127.0.0.1:8080/callback", wantErr: false},
+		{name: "Private-use scheme", uri: "com.example.app:/callback", wantErr: false},
+		{name: "Plain http", uri: "http://app.example.com/callback", wantErr: true},
+		{name: "Fragment", uri: "https://app.example.com/callback#x", wantErr: true},
+		{name: "Relative", uri: "/callback", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateRedirectURI(tt.uri); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateRedirectURI() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// testIssuer mints real scoped JWTs and keeps refresh tokens in memory.
+type testIssuer struct {
+	keys    *auth.KeySet
+	revoked auth.RevocationStore
+	mu      sync.Mutex
+	refresh map[string]testGrant
+}
+
+type testGrant struct {
+	clientID uuid.UUID
+	userID   uuid.UUID
+	scopes   []string
+}
+
+func (i *testIssuer) IssueTokens(r *http.Request, clientID, userID uuid.UUID, scopes []string) (Tokens, error) {
+	accessToken, err := auth.MakeScopedJWT(userID, i.keys, time.Hour, uuid.NewString(), scopes)
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	refreshToken := auth.MakeRefreshToken()
+	i.mu.Lock()
+	i.refresh[refreshToken] = testGrant{clientID, userID, scopes}
+	i.mu.Unlock()
+
+	return Tokens{AccessToken: accessToken, RefreshToken: refreshToken, ExpiresIn: time.Hour, Scopes: scopes}, nil
+}
+
+func (i *testIssuer) RefreshTokens(r *http.Request, clientID uuid.UUID, refreshToken string) (Tokens, error) {
+	i.mu.Lock()
+	grant, ok := i.refresh[refreshToken]
+	if ok && grant.clientID == clientID {
+		delete(i.refresh, refreshToken)
+	}
+	i.mu.Unlock()
+
+	if !ok || grant.clientID != clientID {
+		return Tokens{}, ErrInvalidGrant
+	}
+	return i.IssueTokens(r, clientID, grant.userID, grant.scopes)
+}
+
+func (i *testIssuer) RevokeToken(r *http.Request, clientID uuid.UUID, token string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if grant, ok := i.refresh[token]; ok {
+		if grant.clientID == clientID {
+			delete(i.refresh, token)
+		}
+		return nil
+	}
+
+	claims, err := auth.ParseJWT(token, i.keys)
+	if err != nil {
+		return nil
+	}
+	return i.revoked.RevokeToken(r.Context(), claims.ID, claims.ExpiresAt)
+}
+
+// testClient plays a third-party app talking to the provider over HTTP.
+type testClient struct {
+	t           *testing.T
+	baseURL     string
+	id          uuid.UUID
+	secret      string
+	redirectURI string
+}
+
+func (c *testClient) post(path string, form url.Values) (int, map[string]any) {
+	c.t.Helper()
+
+	if c.secret == "" {
+		form.Set("client_id", c.id.String())
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.baseURL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if c.secret != "" {
+		req.SetBasicAuth(url.QueryEscape(c.id.String()), url.QueryEscape(c.secret))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body := map[string]any{}
+	json.NewDecoder(resp.Body).Decode(&body)
+	return resp.StatusCode, body
+}
+
+func (c *testClient) exchange(code, verifier string) (int, map[string]any) {
+	return c.post("/oauth/token", url.Values{
+		"grant_type": {"authorization_code"},
+		"code": {code},
+		"redirect_uri": {c.redirectURI},
+		"code_verifier": {verifier},
+	})
+}
+
+func (c *testClient) callAPI(accessToken string) int {
+	c.t.Helper()
+
+	req, _ := http.NewRequest(http.MethodPost, c.baseURL+"/api/chirps", nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+type testProvider struct {
+	server *Server
+	store  *MemoryStore
+	http   *httptest.Server
+	userID uuid.UUID
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	keys := auth.NewKeySet("test-secret")
+	revoked := auth.NewMemoryRevocationStore()
+	store := NewMemoryStore()
+	issuer := &testIssuer{keys: keys, revoked: revoked, refresh: map[string]testGrant{}}
+	server := NewServer(store, issuer, auth.DelegableScopes)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /oauth/token", server.HandleToken)
+	mux.HandleFunc("POST /oauth/revoke", server.HandleRevoke)
+	// A resource that needs chirps:write, like POST /api/chirps.
+	mux.HandleFunc("POST /api/chirps", func(w http.ResponseWriter, r *http.Request) {
+		token, err := auth.GetBearerToken(r.Header)
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		claims, err := auth.ParseJWT(token, keys)
+		if err == nil {
+			err = auth.CheckRevocation(r.Context(), revoked, claims)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if !claims.HasScope(auth.ScopeChirpsWrite) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	return &testProvider{server: server, store: store, http: srv, userID: uuid.New()}
+}
+
+func (p *testProvider) registerClient(t *testing.T, secret string) *testClient {
+	client := Client{
+		ID: uuid.New(),
+		Name: "Test app",
+		RedirectURIs: []string{"https://app.example.com/callback"},
+	}
+	if secret != "" {
+		client.SecretHash = auth.HashToken(secret)
+	}
+	p.store.AddClient(client)
+
+	return &testClient{
+		t: t,
+		baseURL: p.http.URL,
+		id: client.ID,
+		secret: secret,
+		redirectURI: client.RedirectURIs[0],
+	}
+}
+
+// authorize stands in for the consent screen: the signed in user approves
+// the request and the browser is sent back with a code.
+func (p *testProvider) authorize(t *testing.T, c *testClient, scope, verifier string) string {
+	t.Helper()
+
+	consent, err := p.server.ValidateAuthorize(context.Background(), AuthorizeRequest{
+		ResponseType: "code",
+		ClientID: c.id.String(),
+		RedirectURI: c.redirectURI,
+		Scope: scope,
+		State: "xyz",
+		CodeChallenge: ChallengeS256(verifier),
+		CodeChallengeMethod: ChallengeMethodS256,
+	})
+	if err != nil {
+		t.Fatalf("ValidateAuthorize() error = %v", err)
+	}
+
+	redirectTo, err := p.server.Approve(context.Background(), p.userID, consent)
+	if err != nil {
+		t.Fatalf("Approve() error = %v", err)
+	}
+
+	u, err := url.Parse(redirectTo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := u.Query().Get("state"); got != "xyz" {
+		t.Errorf("state = %q, want xyz", got)
+	}
+	return u.Query().Get("code")
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	provider := newTestProvider(t)
+	verifier := strings.Repeat("v", 50)
+
+	for _, secret := range []string{"", "client-secret"} {
+		name := "Public client"
+		if secret != "" {
+			name = "Confidential client"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			client := provider.registerClient(t, secret)
+			code := provider.authorize(t, client, "chirps:write messages:read", verifier)
+
+			status, tokens := client.exchange(code, verifier)
+			if status != http.StatusOK {
+				t.Fatalf("token exchange status = %d, body %v", status, tokens)
+			}
+			if tokens["token_type"] != "Bearer" || tokens["scope"] != "chirps:write messages:read" {
+				t.Errorf("token response = %v", tokens)
+			}
+			accessToken, _ := tokens["access_token"].(string)
+			refreshToken, _ := tokens["refresh_token"].(string)
+
+			if got := client.callAPI(accessToken); got != http.StatusCreated {
+				t.Errorf("API call status = %d, want %d", got, http.StatusCreated)
+			}
+
+			if status, body := client.exchange(code, verifier); status != http.StatusBadRequest || body["error"] != "invalid_grant" {
+				t.Errorf("code reuse = %d %v, want invalid_grant", status, body)
+			}
+
+			status, refreshed := client.post("/oauth/token", url.Values{
+				"grant_type": {"refresh_token"},
+				"refresh_token": {refreshToken},
+			})
+			if status != http.StatusOK {
+				t.Fatalf("refresh status = %d, body %v", status, refreshed)
+			}
+			newAccessToken, _ := refreshed["access_token"].(string)
+			newRefreshToken, _ := refreshed["refresh_token"].(string)
+
+			if status, _ := client.post("/oauth/revoke", url.Values{"token": {newAccessToken}}); status != http.StatusOK {
+				t.Errorf("revoke access token status = %d", status)
+			}
+			if got := client.callAPI(newAccessToken); got != http.StatusUnauthorized {
+				t.Errorf("API call with revoked token = %d, want %d", got, http.StatusUnauthorized)
+			}
+
+			if status, _ := client.post("/oauth/revoke", url.Values{"token": {newRefreshToken}}); status != http.StatusOK {
+				t.Errorf("revoke refresh token status = %d", status)
+			}
+			status, body := client.post("/oauth/token", url.Values{
+				"grant_type": {"refresh_token"},
+				"refresh_token": {newRefreshToken},
+			})
+			if status != http.StatusBadRequest || body["error"] != "invalid_grant" {
+				t.Errorf("refresh with revoked token = %d %v, want invalid_grant", status, body)
+			}
+		})
+	}
+}
+
+func TestTokenEndpointErrors(t *testing.T) {
+	provider := newTestProvider(t)
+	verifier := strings.Repeat("v", 50)
+
+	t.Run("Wrong verifier", func(t *testing.T) {
+		client := provider.registerClient(t, "")
+		code := provider.authorize(t, client, "chirps:write", verifier)
+		status, body := client.exchange(code, strings.Repeat("w", 50))
+		if status != http.StatusBadRequest || body["error"] != "invalid_grant" {
+			t.Errorf("got %d %v, want invalid_grant", status, body)
+		}
+	})
+
+	t.Run("Code issued to another client", func(t *testing.T) {
+		client := provider.registerClient(t, "")
+		other := provider.registerClient(t, "")
+		code := provider.authorize(t, client, "chirps:write", verifier)
+		status, body := other.exchange(code, verifier)
+		if status != http.StatusBadRequest || body["error"] != "invalid_grant" {
+			t.Errorf("got %d %v, want invalid_grant", status, body)
+		}
+	})
+
+	t.Run("Wrong client secret", func(t *testing.T) {
+		client := provider.registerClient(t, "client-secret")
+		code := provider.authorize(t, client, "chirps:write", verifier)
+		client.secret = "wrong"
+		status, body := client.exchange(code, verifier)
+		if status != http.StatusUnauthorized || body["error"] != "invalid_client" {
+			t.Errorf("got %d %v, want invalid_client", status, body)
+		}
+	})
+
+	t.Run("Scope not granted", func(t *testing.T) {
+		client := provider.registerClient(t, "")
+		code := provider.authorize(t, client, "messages:read", verifier)
+		_, tokens := client.exchange(code, verifier)
+		accessToken, _ := tokens["access_token"].(string)
+		if got := client.callAPI(accessToken); got != http.StatusForbidden {
+			t.Errorf("API call status = %d, want %d", got, http.StatusForbidden)
+		}
+	})
+
+	t.Run("Unsupported grant type", func(t *testing.T) {
+		client := provider.registerClient(t, "")
+		status, body := client.post("/oauth/token", url.Values{"grant_type": {"password"}})
+		if status != http.StatusBadRequest || body["error"] != "unsupported_grant_type" {
+			t.Errorf("got %d %v, want unsupported_grant_type", status, body)
+		}
+	})
+}
+
+func TestValidateAuthorize(t *testing.T) {
+	provider := newTestProvider(t)
+	client := provider.registerClient(t, "")
+
+	valid := AuthorizeRequest{
+		ResponseType: "code",
+		ClientID: client.id.String(),
+		RedirectURI: client.redirectURI,
+		Scope: "chirps:write",
+		State: "xyz",
+		CodeChallenge: ChallengeS256(strings.Repeat("v", 50)),
+		CodeChallengeMethod: ChallengeMethodS256,
+	}
+
+	tests := []struct {
+		name         string
+		modify       func(*AuthorizeRequest)
+		wantCode     string
+		wantRedirect bool
+	}{
+		{name: "Unknown client", modify: func(r *AuthorizeRequest) { r.ClientID = uuid.NewString() }, wantCode: "invalid_request"},
+		{name: "Unregistered redirect URI", modify: func(r *AuthorizeRequest) { r.RedirectURI = "https://evil.example.com/" }, wantCode: "invalid_request"},
+		{name: "Plain PKCE", modify: func(r *AuthorizeRequest) { r.CodeChallengeMethod = "plain" }, wantCode: "invalid_request", wantRedirect: true},
+		{name: "Account scope", modify: func(r *AuthorizeRequest) { r.Scope = "account" }, wantCode: "invalid_scope", wantRedirect: true},
+		{name: "Token response type", modify: func(r *AuthorizeRequest) { r.ResponseType = "token" }, wantCode: "unsupported_response_type", wantRedirect: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := valid
+			tt.modify(&req)
+
+			_, err := provider.server.ValidateAuthorize(context.Background(), req)
+			oauthErr, ok := err.(*Error)
+			if !ok {
+				t.Fatalf("ValidateAuthorize() error = %v, want *Error", err)
+			}
+			if oauthErr.Code != tt.wantCode {
+				t.Errorf("Code = %v, want %v", oauthErr.Code, tt.wantCode)
+			}
+			if got := oauthErr.RedirectURL() != ""; got != tt.wantRedirect {
+				t.Errorf("redirectable = %v, want %v", got, tt.wantRedirect)
+			}
+		})
+	}
+}
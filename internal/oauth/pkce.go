@@ -0,0 +1,46 @@
+package oauth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+)
+
+// ChallengeMethodS256 is the only PKCE method Chirpy accepts. The plain
+// method would send the verifier itself through the browser.
+const ChallengeMethodS256 = "S256"
+
+// ChallengeS256 derives the S256 code challenge for a PKCE code verifier.
+func ChallengeS256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// VerifyPKCE reports whether verifier is well formed and matches challenge.
+func VerifyPKCE(verifier, challenge string) bool {
+	if !validVerifier(verifier) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(ChallengeS256(verifier)), []byte(challenge)) == 1
+}
+
+// validVerifier checks RFC 7636's rules: 43 to 128 unreserved characters.
+func validVerifier(verifier string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	for _, c := range verifier {
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+		case c == '-', c == '.', c == '_', c == '~':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func validChallenge(challenge string) bool {
+	decoded, err := base64.RawURLEncoding.DecodeString(challenge)
+	return err == nil && len(decoded) == sha256.Size
+}
@@ -0,0 +1,135 @@
+package oauth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+	"github.com/airlangga-hub/chirpy-go/internal/database"
+	"github.com/google/uuid"
+)
+
+var ErrNotFound = errors.New("Not found")
+
+// Store holds registered clients and outstanding authorization codes.
+type Store interface {
+	GetClient(ctx context.Context, clientID uuid.UUID) (Client, error)
+	CreateAuthorizationCode(ctx context.Context, code AuthorizationCode) error
+	// ConsumeAuthorizationCode marks a code used and returns it. Codes that
+	// are unknown, expired or already used return ErrNotFound.
+	ConsumeAuthorizationCode(ctx context.Context, codeHash string) (AuthorizationCode, error)
+}
+
+// MemoryStore keeps clients and codes in process. It's meant for tests.
+type MemoryStore struct {
+	mu      sync.Mutex
+	clients map[uuid.UUID]Client
+	codes   map[string]AuthorizationCode
+	used    map[string]bool
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		clients: map[uuid.UUID]Client{},
+		codes: map[string]AuthorizationCode{},
+		used: map[string]bool{},
+	}
+}
+
+func (s *MemoryStore) AddClient(client Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clients[client.ID] = client
+}
+
+func (s *MemoryStore) GetClient(ctx context.Context, clientID uuid.UUID) (Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	client, ok := s.clients[clientID]
+	if !ok {
+		return Client{}, ErrNotFound
+	}
+	return client, nil
+}
+
+func (s *MemoryStore) CreateAuthorizationCode(ctx context.Context, code AuthorizationCode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.codes[code.CodeHash] = code
+	return nil
+}
+
+func (s *MemoryStore) ConsumeAuthorizationCode(ctx context.Context, codeHash string) (AuthorizationCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code, ok := s.codes[codeHash]
+	if !ok || s.used[codeHash] || !time.Now().Before(code.ExpiresAt) {
+		return AuthorizationCode{}, ErrNotFound
+	}
+	s.used[codeHash] = true
+	return code, nil
+}
+
+// PGStore reads clients and codes from the oauth_clients and
+// oauth_authorization_codes tables.
+type PGStore struct {
+	db *database.Queries
+}
+
+func NewPGStore(db *database.Queries) *PGStore {
+	return &PGStore{db: db}
+}
+
+func (s *PGStore) GetClient(ctx context.Context, clientID uuid.UUID) (Client, error) {
+	dbClient, err := s.db.GetOAuthClient(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Client{}, ErrNotFound
+		}
+		return Client{}, err
+	}
+	return ClientFromDB(dbClient), nil
+}
+
+func (s *PGStore) CreateAuthorizationCode(ctx context.Context, code AuthorizationCode) error {
+	return s.db.CreateOAuthAuthorizationCode(ctx, database.CreateOAuthAuthorizationCodeParams{
+		CodeHash: code.CodeHash,
+		ClientID: code.ClientID,
+		UserID: code.UserID,
+		RedirectUri: code.RedirectURI,
+		Scopes: code.Scopes,
+		CodeChallenge: code.CodeChallenge,
+		ExpiresAt: code.ExpiresAt,
+	})
+}
+
+func (s *PGStore) ConsumeAuthorizationCode(ctx context.Context, codeHash string) (AuthorizationCode, error) {
+	dbCode, err := s.db.ConsumeOAuthAuthorizationCode(ctx, codeHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return AuthorizationCode{}, ErrNotFound
+		}
+		return AuthorizationCode{}, err
+	}
+	return AuthorizationCode{
+		CodeHash: dbCode.CodeHash,
+		ClientID: dbCode.ClientID,
+		UserID: dbCode.UserID,
+		RedirectURI: dbCode.RedirectUri,
+		Scopes: dbCode.Scopes,
+		CodeChallenge: dbCode.CodeChallenge,
+		ExpiresAt: dbCode.ExpiresAt,
+	}, nil
+}
+
+func ClientFromDB(dbClient database.OauthClient) Client {
+	return Client{
+		ID: dbClient.ID,
+		Name: dbClient.Name,
+		SecretHash: dbClient.SecretHash.String,
+		RedirectURIs: dbClient.RedirectUris,
+	}
+}
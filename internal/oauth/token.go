@@ -0,0 +1,203 @@
+package oauth
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"github.com/airlangga-hub/chirpy-go/internal/auth"
+	"github.com/google/uuid"
+)
+
+const maxFormSize = 1 << 16
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope"`
+}
+
+// HandleToken is the token endpoint. It trades authorization codes and
+// refresh tokens for new tokens.
+func (s *Server) HandleToken(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxFormSize)
+	if err := r.ParseForm(); err != nil {
+		writeError(w, newError(400, "invalid_request", "Couldn't parse form"))
+		return
+	}
+
+	client, err := s.authenticateClient(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var tokens Tokens
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		tokens, err = s.exchangeCode(r, client)
+	case "refresh_token":
+		refreshToken := r.PostForm.Get("refresh_token")
+		if refreshToken == "" {
+			writeError(w, newError(400, "invalid_request", "refresh_token is required"))
+			return
+		}
+		tokens, err = s.issuer.RefreshTokens(r, client.ID, refreshToken)
+		if errors.Is(err, ErrInvalidGrant) {
+			err = newError(400, "invalid_grant", "Invalid refresh token")
+		}
+	default:
+		err = newError(400, "unsupported_grant_type", "Only authorization_code and refresh_token grants are supported")
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	writeJSON(w, http.StatusOK, tokenResponse{
+		AccessToken: tokens.AccessToken,
+		TokenType: "Bearer",
+		ExpiresIn: int(tokens.ExpiresIn.Seconds()),
+		RefreshToken: tokens.RefreshToken,
+		Scope: strings.Join(tokens.Scopes, " "),
+	})
+}
+
+func (s *Server) exchangeCode(r *http.Request, client Client) (Tokens, error) {
+	code := r.PostForm.Get("code")
+	verifier := r.PostForm.Get("code_verifier")
+	if code == "" || verifier == "" {
+		return Tokens{}, newError(400, "invalid_request", "code and code_verifier are required")
+	}
+
+	// The code is spent even if the checks below fail, so a stolen code
+	// can't be retried with different guesses.
+	stored, err := s.store.ConsumeAuthorizationCode(r.Context(), auth.HashToken(code))
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return Tokens{}, newError(400, "invalid_grant", "Invalid authorization code")
+		}
+		return Tokens{}, err
+	}
+
+	if stored.ClientID != client.ID {
+		return Tokens{}, newError(400, "invalid_grant", "Invalid authorization code")
+	}
+	if redirectURI := r.PostForm.Get("redirect_uri"); redirectURI != "" && redirectURI != stored.RedirectURI {
+		return Tokens{}, newError(400, "invalid_grant", "redirect_uri doesn't match the authorization request")
+	}
+	if !VerifyPKCE(verifier, stored.CodeChallenge) {
+		return Tokens{}, newError(400, "invalid_grant", "code_verifier doesn't match the code challenge")
+	}
+
+	return s.issuer.IssueTokens(r, client.ID, stored.UserID, stored.Scopes)
+}
+
+// HandleRevoke is the RFC 7009 revocation endpoint. It answers 200 even for
+// tokens it doesn't know, so clients can't probe for valid ones.
+func (s *Server) HandleRevoke(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxFormSize)
+	if err := r.ParseForm(); err != nil {
+		writeError(w, newError(400, "invalid_request", "Couldn't parse form"))
+		return
+	}
+
+	client, err := s.authenticateClient(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	if token == "" {
+		writeError(w, newError(400, "invalid_request", "token is required"))
+		return
+	}
+
+	if err := s.issuer.RevokeToken(r, client.ID, token); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// authenticateClient identifies the client from HTTP Basic credentials or
+// the client_id and client_secret form fields. Public clients only send
+// client_id.
+func (s *Server) authenticateClient(r *http.Request) (Client, error) {
+	rawID, secret, basic := r.BasicAuth()
+	if basic {
+		// RFC 6749 section 2.3.1 form-encodes both halves before Basic
+		// encoding them.
+		var err error
+		if rawID, err = url.QueryUnescape(rawID); err != nil {
+			return Client{}, invalidClient(basic)
+		}
+		if secret, err = url.QueryUnescape(secret); err != nil {
+			return Client{}, invalidClient(basic)
+		}
+	} else {
+		rawID = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+
+	clientID, err := uuid.Parse(rawID)
+	if err != nil {
+		return Client{}, invalidClient(basic)
+	}
+
+	client, err := s.store.GetClient(r.Context(), clientID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return Client{}, invalidClient(basic)
+		}
+		return Client{}, err
+	}
+
+	if !client.Public() && subtle.ConstantTimeCompare([]byte(auth.HashToken(secret)), []byte(client.SecretHash)) != 1 {
+		return Client{}, invalidClient(basic)
+	}
+
+	return client, nil
+}
+
+func invalidClient(basic bool) *Error {
+	e := newError(401, "invalid_client", "Client authentication failed")
+	e.basic = basic
+	return e
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	var e *Error
+	if !errors.As(err, &e) {
+		log.Printf("OAuth server error: %s", err)
+		e = newError(500, "server_error", "Something went wrong")
+	}
+	if e.basic {
+		w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, e.status, e)
+}
+
+func writeJSON(w http.ResponseWriter, code int, payload any) {
+	w.Header().Set("Content-Type", "application/json")
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Error marshaling JSON: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	w.WriteHeader(code)
+	w.Write(data)
+}
@@ -0,0 +1,321 @@
+package oidc
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	discoveryPath = "/.well-known/openid-configuration"
+	httpTimeout = 10 * time.Second
+	maxResponseSize = 1 << 20
+
+	// An unknown kid triggers a JWKS refetch, since the issuer may have
+	// rotated keys, but no more often than this.
+	minKeyRefreshInterval = time.Minute
+)
+
+var defaultScopes = []string{"openid", "email", "profile"}
+
+var signingMethods = []string{
+	jwt.SigningMethodRS256.Alg(),
+	jwt.SigningMethodES256.Alg(),
+	jwt.SigningMethodEdDSA.Alg(),
+}
+
+// Config describes one identity provider. Name identifies it in Chirpy's
+// URLs; Issuer is where its discovery document lives.
+type Config struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	HTTPClient   *http.Client
+}
+
+// Metadata is the part of the discovery document Chirpy uses.
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// IDToken holds the verified claims of an ID token that Chirpy cares about.
+type IDToken struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// Provider signs users in with an OpenID Connect issuer. Discovery runs on
+// first use and is cached, so an issuer that is down at startup doesn't stop
+// Chirpy from starting.
+type Provider struct {
+	cfg    Config
+	client *http.Client
+
+	mu            sync.Mutex
+	metadata      *Metadata
+	keys          map[string]any
+	keysFetchedAt time.Time
+}
+
+func NewProvider(cfg Config) *Provider {
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = defaultScopes
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: httpTimeout}
+	}
+	return &Provider{cfg: cfg, client: client}
+}
+
+func (p *Provider) Name() string {
+	return p.cfg.Name
+}
+
+// Discover fetches and caches the issuer's discovery document. The issuer it
+// names must be exactly the configured one.
+func (p *Provider) Discover(ctx context.Context) (*Metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	var metadata Metadata
+	if err := p.getJSON(ctx, strings.TrimSuffix(p.cfg.Issuer, "/")+discoveryPath, &metadata); err != nil {
+		return nil, fmt.Errorf("Couldn't discover %s: %w", p.cfg.Issuer, err)
+	}
+	if metadata.Issuer != p.cfg.Issuer {
+		return nil, fmt.Errorf("Discovery document is for issuer %q, not %q", metadata.Issuer, p.cfg.Issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, errors.New("Discovery document is missing an endpoint")
+	}
+
+	p.metadata = &metadata
+	return p.metadata, nil
+}
+
+// AuthCodeURL is where to send the user's browser to sign in. state is
+// checked on the way back, nonce ends up in the ID token and codeChallenge is
+// the PKCE S256 challenge for the verifier Exchange will send.
+func (p *Provider) AuthCodeURL(ctx context.Context, redirectURI, state, nonce, codeChallenge string) (string, error) {
+	metadata, err := p.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(metadata.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.cfg.ClientID)
+	query.Set("redirect_uri", redirectURI)
+	query.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+// Exchange trades an authorization code for the raw ID token.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, redirectURI string) (string, error) {
+	metadata, err := p.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type": {"authorization_code"},
+		"code": {code},
+		"redirect_uri": {redirectURI},
+		"code_verifier": {codeVerifier},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var tokens struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&tokens); err != nil {
+		return "", fmt.Errorf("Couldn't decode token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Token endpoint returned %d: %s %s", resp.StatusCode, tokens.Error, tokens.ErrorDescription)
+	}
+	if tokens.IDToken == "" {
+		return "", errors.New("Token response has no id_token")
+	}
+
+	return tokens.IDToken, nil
+}
+
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce           string   `json:"nonce"`
+	AuthorizedParty string   `json:"azp"`
+	Email           string   `json:"email"`
+	EmailVerified   flexBool `json:"email_verified"`
+	Name            string   `json:"name"`
+}
+
+// flexBool accepts true and "true": some providers send email_verified as a
+// string.
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	switch string(data) {
+	case "true", `"true"`:
+		*b = true
+	default:
+		*b = false
+	}
+	return nil
+}
+
+// VerifyIDToken checks the ID token's signature against the issuer's keys,
+// its issuer, audience, expiry and nonce, and returns its claims.
+func (p *Provider) VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (IDToken, error) {
+	metadata, err := p.Discover(ctx)
+	if err != nil {
+		return IDToken{}, err
+	}
+
+	claims := idTokenClaims{}
+	_, err = jwt.ParseWithClaims(
+		rawIDToken,
+		&claims,
+		func(token *jwt.Token) (any, error) { return p.key(ctx, token) },
+		jwt.WithValidMethods(signingMethods),
+		jwt.WithIssuer(metadata.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return IDToken{}, err
+	}
+
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.cfg.ClientID {
+		return IDToken{}, errors.New("ID token was issued to another party")
+	}
+	if nonce == "" || subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return IDToken{}, errors.New("ID token nonce doesn't match")
+	}
+	if claims.Subject == "" {
+		return IDToken{}, errors.New("ID token has no subject")
+	}
+
+	return IDToken{
+		Subject: claims.Subject,
+		Email: claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+		Name: claims.Name,
+	}, nil
+}
+
+// key finds the verification key for an ID token by its kid, refetching the
+// issuer's JWKS when the kid is unknown.
+func (p *Provider) key(ctx context.Context, token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key, ok := p.keys[kid]
+	if !ok && time.Since(p.keysFetchedAt) >= minKeyRefreshInterval {
+		keys, err := p.fetchKeys(ctx)
+		if err != nil {
+			return nil, err
+		}
+		p.keys = keys
+		p.keysFetchedAt = time.Now()
+		key, ok = p.keys[kid]
+	}
+	if !ok {
+		return nil, fmt.Errorf("Unknown key ID %q", kid)
+	}
+
+	if !keyMatchesMethod(key, token.Method) {
+		return nil, fmt.Errorf("Key %s doesn't sign with %s", kid, token.Method.Alg())
+	}
+	return key, nil
+}
+
+func (p *Provider) fetchKeys(ctx context.Context) (map[string]any, error) {
+	var jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := p.getJSON(ctx, p.metadata.JWKSURI, &jwks); err != nil {
+		return nil, fmt.Errorf("Couldn't fetch JWKS: %w", err)
+	}
+
+	keys := map[string]any{}
+	for _, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.KeyID] = key
+	}
+	return keys, nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, rawURL string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %d", rawURL, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(v)
+}
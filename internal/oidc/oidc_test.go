@@ -0,0 +1,379 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockIssuer is a minimal OpenID Connect provider. login stands in for the
+// user signing in at the authorization endpoint.
+type mockIssuer struct {
+	server       *httptest.Server
+	clientID     string
+	clientSecret string
+
+	mu    sync.Mutex
+	kid   string
+	key   crypto.Signer
+	codes map[string]mockCode
+}
+
+type mockCode struct {
+	claims      jwt.MapClaims
+	challenge   string
+	redirectURI string
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &mockIssuer{
+		clientID: "chirpy",
+		clientSecret: "s3cret",
+		kid: "rsa-1",
+		key: key,
+		codes: map[string]mockCode{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Metadata{
+			Issuer: m.server.URL,
+			AuthorizationEndpoint: m.server.URL + "/authorize",
+			TokenEndpoint: m.server.URL + "/token",
+			JWKSURI: m.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", m.handleJWKS)
+	mux.HandleFunc("POST /token", m.handleToken)
+
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func (m *mockIssuer) provider() *Provider {
+	return NewProvider(Config{
+		Name: "mock",
+		Issuer: m.server.URL,
+		ClientID: m.clientID,
+		ClientSecret: m.clientSecret,
+	})
+}
+
+func (m *mockIssuer) rotate(kid string, key crypto.Signer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.kid = kid
+	m.key = key
+}
+
+func (m *mockIssuer) sign(claims jwt.MapClaims) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	method := jwt.SigningMethod(jwt.SigningMethodRS256)
+	if _, ok := m.key.(ed25519.PrivateKey); ok {
+		method = jwt.SigningMethodEdDSA
+	}
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = m.kid
+	signed, err := token.SignedString(m.key)
+	if err != nil {
+		panic(err)
+	}
+	return signed
+}
+
+func (m *mockIssuer) claims(subject, email, nonce string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss": m.server.URL,
+		"aud": m.clientID,
+		"sub": subject,
+		"iat": now.Unix(),
+		"exp": now.Add(5 * time.Minute).Unix(),
+		"nonce": nonce,
+		"email": email,
+		"email_verified": true,
+	}
+}
+
+// login follows an authorization URL as a signed in user would and returns
+// the code the issuer redirects back with.
+func (m *mockIssuer) login(t *testing.T, authURL, subject, email string) string {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	if query.Get("client_id") != m.clientID || query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("unexpected authorization request %s", authURL)
+	}
+
+	code := rand.Text()
+	m.mu.Lock()
+	m.codes[code] = mockCode{
+		claims: m.claims(subject, email, query.Get("nonce")),
+		challenge: query.Get("code_challenge"),
+		redirectURI: query.Get("redirect_uri"),
+	}
+	m.mu.Unlock()
+	return code
+}
+
+func (m *mockIssuer) handleToken(w http.ResponseWriter, r *http.Request) {
+	id, secret, _ := r.BasicAuth()
+	if id != m.clientID || secret != m.clientSecret {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	r.ParseForm()
+	m.mu.Lock()
+	code, ok := m.codes[r.PostForm.Get("code")]
+	delete(m.codes, r.PostForm.Get("code"))
+	m.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || code.redirectURI != r.PostForm.Get("redirect_uri") || base64.RawURLEncoding.EncodeToString(sum[:]) != code.challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"access_token": "unused",
+		"token_type": "Bearer",
+		"id_token": m.sign(code.claims),
+	})
+}
+
+func (m *mockIssuer) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var key jwk
+	switch public := m.key.Public().(type) {
+	case *rsa.PublicKey:
+		key = jwk{
+			KeyType: "RSA",
+			N: base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+			E: base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+		}
+	case ed25519.PublicKey:
+		key = jwk{KeyType: "OKP", Curve: "Ed25519", X: base64.RawURLEncoding.EncodeToString(public)}
+	}
+	key.KeyID = m.kid
+	key.Use = "sig"
+
+	json.NewEncoder(w).Encode(map[string][]jwk{"keys": {key}})
+}
+
+func TestLoginFlow(t *testing.T) {
+	issuer := newMockIssuer(t)
+	provider := issuer.provider()
+	ctx := context.Background()
+
+	redirectURI := "http://localhost:8080/api/oidc/mock/callback"
+	verifier := rand.Text() + rand.Text()
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	authURL, err := provider.AuthCodeURL(ctx, redirectURI, "state-1", "nonce-1", challenge)
+	if err != nil {
+		t.Fatalf("AuthCodeURL() error = %v", err)
+	}
+	if !strings.HasPrefix(authURL, issuer.server.URL+"/authorize?") {
+		t.Fatalf("AuthCodeURL() = %v", authURL)
+	}
+
+	code := issuer.login(t, authURL, "employee-42", "ada@example.com")
+
+	rawIDToken, err := provider.Exchange(ctx, code, verifier, redirectURI)
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+
+	idToken, err := provider.VerifyIDToken(ctx, rawIDToken, "nonce-1")
+	if err != nil {
+		t.Fatalf("VerifyIDToken() error = %v", err)
+	}
+	want := IDToken{Subject: "employee-42", Email: "ada@example.com", EmailVerified: true}
+	if idToken != want {
+		t.Errorf("VerifyIDToken() = %+v, want %+v", idToken, want)
+	}
+
+	if _, err := provider.Exchange(ctx, code, verifier, redirectURI); err == nil {
+		t.Error("Exchange() reused a code without error")
+	}
+	if _, err := provider.Exchange(ctx, issuer.login(t, authURL, "employee-42", ""), "wrong-verifier", redirectURI); err == nil {
+		t.Error("Exchange() with the wrong verifier succeeded")
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	issuer := newMockIssuer(t)
+	provider := issuer.provider()
+	ctx := context.Background()
+
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	tests := []struct {
+		name    string
+		token   func() string
+		nonce   string
+		wantErr bool
+	}{
+		{
+			name: "Valid",
+			token: func() string { return issuer.sign(issuer.claims("sub", "a@example.com", "n")) },
+			nonce: "n",
+		},
+		{
+			name: "Wrong nonce",
+			token: func() string { return issuer.sign(issuer.claims("sub", "a@example.com", "n")) },
+			nonce: "other",
+			wantErr: true,
+		},
+		{
+			name: "Wrong audience",
+			token: func() string {
+				claims := issuer.claims("sub", "a@example.com", "n")
+				claims["aud"] = "someone-else"
+				return issuer.sign(claims)
+			},
+			nonce: "n",
+			wantErr: true,
+		},
+		{
+			name: "Multiple audiences without azp",
+			token: func() string {
+				claims := issuer.claims("sub", "a@example.com", "n")
+				claims["aud"] = []string{issuer.clientID, "someone-else"}
+				return issuer.sign(claims)
+			},
+			nonce: "n",
+			wantErr: true,
+		},
+		{
+			name: "Wrong issuer",
+			token: func() string {
+				claims := issuer.claims("sub", "a@example.com", "n")
+				claims["iss"] = "https://evil.example.com"
+				return issuer.sign(claims)
+			},
+			nonce: "n",
+			wantErr: true,
+		},
+		{
+			name: "Expired",
+			token: func() string {
+				claims := issuer.claims("sub", "a@example.com", "n")
+				claims["exp"] = time.Now().Add(-time.Hour).Unix()
+				return issuer.sign(claims)
+			},
+			nonce: "n",
+			wantErr: true,
+		},
+		{
+			name: "Signed by an unknown key with a known kid",
+			token: func() string {
+				token := jwt.NewWithClaims(jwt.SigningMethodRS256, issuer.claims("sub", "a@example.com", "n"))
+				token.Header["kid"] = issuer.kid
+				signed, _ := token.SignedString(otherKey)
+				return signed
+			},
+			nonce: "n",
+			wantErr: true,
+		},
+		{
+			name: "HS256 with the client secret",
+			token: func() string {
+				token := jwt.NewWithClaims(jwt.SigningMethodHS256, issuer.claims("sub", "a@example.com", "n"))
+				token.Header["kid"] = issuer.kid
+				signed, _ := token.SignedString([]byte(issuer.clientSecret))
+				return signed
+			},
+			nonce: "n",
+			wantErr: true,
+		},
+		{
+			name: "String email_verified",
+			token: func() string {
+				claims := issuer.claims("sub", "a@example.com", "n")
+				claims["email_verified"] = "true"
+				return issuer.sign(claims)
+			},
+			nonce: "n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idToken, err := provider.VerifyIDToken(ctx, tt.token(), tt.nonce)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VerifyIDToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !idToken.EmailVerified {
+				t.Errorf("EmailVerified = false, want true")
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenKeyRotation(t *testing.T) {
+	issuer := newMockIssuer(t)
+	provider := issuer.provider()
+	ctx := context.Background()
+
+	if _, err := provider.VerifyIDToken(ctx, issuer.sign(issuer.claims("sub", "", "n")), "n"); err != nil {
+		t.Fatalf("VerifyIDToken() error = %v", err)
+	}
+
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	issuer.rotate("ed-2", edKey)
+	rotated := issuer.sign(issuer.claims("sub", "", "n"))
+
+	if _, err := provider.VerifyIDToken(ctx, rotated, "n"); err == nil {
+		t.Fatal("VerifyIDToken() refetched keys before the refresh interval")
+	}
+
+	provider.keysFetchedAt = time.Time{}
+	if _, err := provider.VerifyIDToken(ctx, rotated, "n"); err != nil {
+		t.Errorf("VerifyIDToken() after rotation error = %v", err)
+	}
+}
+
+func TestDiscoverIssuerMismatch(t *testing.T) {
+	issuer := newMockIssuer(t)
+
+	provider := NewProvider(Config{
+		Name: "mock",
+		Issuer: issuer.server.URL + "/",
+		ClientID: issuer.clientID,
+	})
+
+	if _, err := provider.Discover(context.Background()); err == nil {
+		t.Error("Discover() accepted a document for a different issuer")
+	}
+}
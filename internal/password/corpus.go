@@ -0,0 +1,161 @@
+package password
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// PrefixLength is how many hex digits of a password's SHA-1 are used to
+// query a Corpus.
+const PrefixLength = 5
+
+// Corpus answers k-anonymity range queries like the Pwned Passwords API:
+// given the first PrefixLength hex digits of a SHA-1, it returns the rest of
+// every breached hash that starts with them, with how many times each was
+// seen. Only the prefix is ever asked about, so a corpus behind another
+// service never learns which password is being checked.
+type Corpus interface {
+	Range(prefix string) (map[string]int, error)
+}
+
+// Breached returns how many times password appears in corpus.
+func Breached(corpus Corpus, password string) (int, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	suffixes, err := corpus.Range(hash[:PrefixLength])
+	if err != nil {
+		return 0, err
+	}
+	return suffixes[hash[PrefixLength:]], nil
+}
+
+// FileCorpus is a Corpus read from a local file of "HASH:COUNT" lines sorted
+// by hash, which is how the Pwned Passwords downloader writes SHA-1 hashes.
+// Ranges are found by binary search, so the file is never loaded into memory.
+type FileCorpus struct {
+	file *os.File
+	size int64
+}
+
+// OpenFileCorpus opens the corpus at path.
+func OpenFileCorpus(path string) (*FileCorpus, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &FileCorpus{file: file, size: info.Size()}, nil
+}
+
+func (c *FileCorpus) Close() error {
+	return c.file.Close()
+}
+
+func (c *FileCorpus) Range(prefix string) (map[string]int, error) {
+	prefix = strings.ToUpper(prefix)
+	if len(prefix) != PrefixLength {
+		return nil, fmt.Errorf("Range prefix must be %d hex digits", PrefixLength)
+	}
+
+	// Find the first offset whose line sorts at or after prefix.
+	lo, hi := int64(0), c.size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		start, err := c.lineStart(mid)
+		if err != nil {
+			return nil, err
+		}
+		key, err := c.keyAt(start)
+		if err != nil {
+			return nil, err
+		}
+		if key >= prefix {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+
+	start, err := c.lineStart(lo)
+	if err != nil {
+		return nil, err
+	}
+
+	suffixes := map[string]int{}
+	scanner := bufio.NewScanner(io.NewSectionReader(c.file, start, c.size-start))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(strings.ToUpper(line), prefix) {
+			break
+		}
+
+		hash, count, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("Malformed corpus line %q", line)
+		}
+		n, err := strconv.Atoi(count)
+		if err != nil {
+			return nil, fmt.Errorf("Malformed corpus line %q", line)
+		}
+		suffixes[strings.ToUpper(hash[PrefixLength:])] = n
+	}
+
+	return suffixes, scanner.Err()
+}
+
+// lineStart returns the offset of the first line that starts at or after
+// off.
+func (c *FileCorpus) lineStart(off int64) (int64, error) {
+	if off == 0 {
+		return 0, nil
+	}
+
+	buf := make([]byte, 128)
+	for pos := off - 1; pos < c.size; {
+		n, err := c.file.ReadAt(buf, pos)
+		if i := bytes.IndexByte(buf[:n], '\n'); i >= 0 {
+			return pos + int64(i) + 1, nil
+		}
+		pos += int64(n)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return c.size, nil
+}
+
+// keyAt returns the hash prefix of the line at off, or a key sorting after
+// every prefix at the end of the file.
+func (c *FileCorpus) keyAt(off int64) (string, error) {
+	if off >= c.size {
+		return "~", nil
+	}
+
+	buf := make([]byte, PrefixLength)
+	n, err := c.file.ReadAt(buf, off)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return strings.ToUpper(string(buf[:n])), nil
+}
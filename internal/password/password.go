@@ -0,0 +1,113 @@
+// Package password decides whether a password is good enough to accept: long
+// enough, hard enough to guess, unrelated to the account it protects, and
+// absent from known breaches.
+package password
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxLength bounds how much work hashing and scoring a password can cost.
+const MaxLength = 128
+
+// Violation codes, for clients that want to explain them in their own words.
+const (
+	CodeTooShort = "too_short"
+	CodeTooLong = "too_long"
+	CodeContainsEmail = "contains_email"
+	CodeTooWeak = "too_weak"
+	CodeBreached = "breached"
+)
+
+// Violation is one reason a password was refused.
+type Violation struct {
+	Code    string
+	Message string
+}
+
+// Policy is what a new password must satisfy. MinScore is a strength score
+// from 0 (trivially guessed) to 4 (very hard to guess); see Score. Breached,
+// when set, refuses passwords found in a breach corpus.
+type Policy struct {
+	MinLength int
+	MinScore  int
+	Breached  Corpus
+}
+
+// DefaultPolicy asks for 8 characters and a score of at least 2.
+var DefaultPolicy = Policy{
+	MinLength: 8,
+	MinScore: 2,
+}
+
+// Check returns every way password falls short of p, for an account with the
+// given email. userInputs are other details about the user, like their
+// handle, which count as easy guesses when scoring. The error is only set if
+// the breach corpus couldn't be searched; the violations are still complete
+// apart from that check.
+func (p Policy) Check(password, email string, userInputs ...string) ([]Violation, error) {
+	var violations []Violation
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		violations = append(violations, Violation{
+			Code: CodeTooShort,
+			Message: fmt.Sprintf("Password must be at least %d characters", p.MinLength),
+		})
+	}
+	if length > MaxLength {
+		return append(violations, Violation{
+			Code: CodeTooLong,
+			Message: fmt.Sprintf("Password must be at most %d characters", MaxLength),
+		}), nil
+	}
+
+	if containsEmail(password, email) {
+		violations = append(violations, Violation{
+			Code: CodeContainsEmail,
+			Message: "Password must not contain your email address",
+		})
+	}
+
+	if Score(password, append(userInputs, email)...) < p.MinScore {
+		violations = append(violations, Violation{
+			Code: CodeTooWeak,
+			Message: "Password is too easy to guess; try a longer passphrase of unrelated words",
+		})
+	}
+
+	if p.Breached == nil || password == "" {
+		return violations, nil
+	}
+
+	count, err := Breached(p.Breached, password)
+	if err != nil {
+		return violations, err
+	}
+	if count > 0 {
+		violations = append(violations, Violation{
+			Code: CodeBreached,
+			Message: "Password has appeared in a data breach; choose a different one",
+		})
+	}
+
+	return violations, nil
+}
+
+// containsEmail reports whether password contains email, or the part before
+// the @ when that is long enough to mean something.
+func containsEmail(password, email string) bool {
+	password = strings.ToLower(password)
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return false
+	}
+	if strings.Contains(password, email) {
+		return true
+	}
+
+	local, _, _ := strings.Cut(email, "@")
+	return utf8.RuneCountInString(local) >= 3 && strings.Contains(password, local)
+}
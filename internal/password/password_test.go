@@ -0,0 +1,143 @@
+package password
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		password string
+		inputs   []string
+		maxScore int
+		minScore int
+	}{
+		{password: "", maxScore: 0},
+		{password: "password", maxScore: 0},
+		{password: "P@ssw0rd", maxScore: 1},
+		{password: "qwertyuiop", maxScore: 1},
+		{password: "abcdefgh", maxScore: 1},
+		{password: "aaaaaaaaaaaa", maxScore: 1},
+		{password: "drowssap", maxScore: 1},
+		{password: "monkey1990", maxScore: 2},
+		{password: "ada.lovelace", inputs: []string{"ada.lovelace@example.com"}, maxScore: 1},
+		{password: "correct horse battery staple", minScore: 4, maxScore: 4},
+		{password: "Tr0ub4dor&3xq!", minScore: 3, maxScore: 4},
+		{password: "j8#Lq2!vZp9w", minScore: 4, maxScore: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.password, func(t *testing.T) {
+			score := Score(tt.password, tt.inputs...)
+			if score < tt.minScore || score > tt.maxScore {
+				t.Errorf("Score(%q) = %d, want %d-%d (%.0f guesses)", tt.password, score, tt.minScore, tt.maxScore, Guesses(tt.password, tt.inputs...))
+			}
+		})
+	}
+}
+
+func TestScoreLongRepeats(t *testing.T) {
+	// Mostly a check that scoring stays fast on the longest passwords.
+	for _, password := range []string{
+		strings.Repeat("a", MaxLength),
+		strings.Repeat("ab", MaxLength/2),
+		strings.Repeat("abc1", MaxLength/4),
+	} {
+		if score := Score(password); score > 2 {
+			t.Errorf("Score(%q) = %d, want at most 2", password, score)
+		}
+	}
+}
+
+func TestFileCorpus(t *testing.T) {
+	// SHA-1 of "password" is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8.
+	lines := []string{
+		"000000005AD76BD555C1D6D771DE417A4B87E4B4:10",
+		"5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD7:1",
+		"5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:9659365",
+		"5BAA700000000000000000000000000000000000:3",
+		"FFFFFFFEE791CBAC0F6305CAF0CEE06BBE131160:2",
+	}
+	path := filepath.Join(t.TempDir(), "pwned.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\r\n")+"\r\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	corpus, err := OpenFileCorpus(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer corpus.Close()
+
+	suffixes, err := corpus.Range("5baa6")
+	if err != nil {
+		t.Fatalf("Range() error = %v", err)
+	}
+	if len(suffixes) != 2 || suffixes["1E4C9B93F3F0682250B6CF8331B7EE68FD8"] != 9659365 {
+		t.Errorf("Range() = %v", suffixes)
+	}
+
+	for _, prefix := range []string{"00000", "FFFFF"} {
+		if suffixes, err := corpus.Range(prefix); err != nil || len(suffixes) != 1 {
+			t.Errorf("Range(%s) = %v, %v; want one suffix", prefix, suffixes, err)
+		}
+	}
+	if suffixes, err := corpus.Range("12345"); err != nil || len(suffixes) != 0 {
+		t.Errorf("Range(12345) = %v, %v; want none", suffixes, err)
+	}
+
+	if count, err := Breached(corpus, "password"); err != nil || count != 9659365 {
+		t.Errorf("Breached(password) = %d, %v", count, err)
+	}
+	if count, err := Breached(corpus, "not in the corpus"); err != nil || count != 0 {
+		t.Errorf("Breached(not in the corpus) = %d, %v", count, err)
+	}
+}
+
+func TestPolicyCheck(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pwned.txt")
+	// SHA-1 of "correct horse battery staple".
+	if err := os.WriteFile(path, []byte("ABF7AAD6438836DBE526AA231ABDE2D0EEF74D42:123\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	corpus, err := OpenFileCorpus(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer corpus.Close()
+
+	policy := DefaultPolicy
+	policy.Breached = corpus
+
+	tests := []struct {
+		name      string
+		password  string
+		wantCodes []string
+	}{
+		{name: "Empty", password: "", wantCodes: []string{CodeTooShort, CodeTooWeak}},
+		{name: "Too long", password: strings.Repeat("x", MaxLength+1), wantCodes: []string{CodeTooLong}},
+		{name: "Contains email", password: "zq8!ada.lovelace@example.com#", wantCodes: []string{CodeContainsEmail}},
+		{name: "Contains local part", password: "Ada.Lovelace-7fq#", wantCodes: []string{CodeContainsEmail}},
+		{name: "Weak", password: "password1", wantCodes: []string{CodeTooWeak}},
+		{name: "Breached", password: "correct horse battery staple", wantCodes: []string{CodeBreached}},
+		{name: "Good", password: "violet kettle umbrella 42", wantCodes: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations, err := policy.Check(tt.password, "ada.lovelace@example.com", "ada")
+			if err != nil {
+				t.Fatalf("Check() error = %v", err)
+			}
+			var codes []string
+			for _, v := range violations {
+				codes = append(codes, v.Code)
+			}
+			if strings.Join(codes, ",") != strings.Join(tt.wantCodes, ",") {
+				t.Errorf("Check() codes = %v, want %v", codes, tt.wantCodes)
+			}
+		})
+	}
+}
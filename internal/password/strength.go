@@ -0,0 +1,417 @@
+package password
+
+import (
+	_ "embed"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// The estimate follows zxcvbn: find the patterns people build passwords
+// from, price each by how many guesses an attacker trying that pattern would
+// need, then take the cheapest way to cover the password with patterns and
+// brute force.
+
+const (
+	bruteforceCardinality = 10
+	minSingleCharGuesses = 11
+	minMultiCharGuesses = 51
+
+	// Every extra pattern in a password multiplies the attacker's work by at
+	// least this much, which stops a long password from scoring low just
+	// because it can be split into many tiny patterns.
+	minGuessesPerPattern = 10000
+
+	minYearSpace = 20
+	keyboardStarts = 47
+	keyboardDegree = 4
+)
+
+//go:embed common_passwords.txt
+var commonPasswordsFile string
+
+// commonPasswords ranks common passwords and words by popularity, 1 first.
+var commonPasswords = sync.OnceValue(func() map[string]int {
+	ranks := map[string]int{}
+	for i, word := range strings.Fields(commonPasswordsFile) {
+		if _, ok := ranks[word]; !ok {
+			ranks[word] = i + 1
+		}
+	}
+	return ranks
+})
+
+var keyboardRows = []string{
+	"`1234567890-=",
+	"qwertyuiop[]\\",
+	"asdfghjkl;'",
+	"zxcvbnm,./",
+}
+
+var l33tTables = []map[rune]rune{
+	{'4': 'a', '@': 'a', '8': 'b', '(': 'c', '3': 'e', '6': 'g', '1': 'i', '!': 'i', '|': 'i', '0': 'o', '$': 's', '5': 's', '7': 't', '+': 't', '2': 'z'},
+	{'4': 'a', '@': 'a', '8': 'b', '(': 'c', '3': 'e', '6': 'g', '1': 'l', '!': 'i', '|': 'l', '0': 'o', '$': 's', '5': 's', '7': 't', '+': 't', '2': 'z'},
+}
+
+type match struct {
+	i, j    int
+	guesses float64
+}
+
+// Score rates how hard password is to guess, from 0 to 4:
+//
+//	0: under a thousand guesses, e.g. a top-ten password
+//	1: under a million, stops throttled online guessing
+//	2: under 10^8, stops unthrottled online guessing
+//	3: under 10^10, holds up somewhat if the hashes leak
+//	4: more than that
+//
+// userInputs, like the user's email and handle, are treated as the first
+// words an attacker would try.
+func Score(password string, userInputs ...string) int {
+	guesses := Guesses(password, userInputs...)
+	switch {
+	case guesses < 1e3:
+		return 0
+	case guesses < 1e6:
+		return 1
+	case guesses < 1e8:
+		return 2
+	case guesses < 1e10:
+		return 3
+	}
+	return 4
+}
+
+// Guesses estimates how many guesses it would take to find password.
+func Guesses(password string, userInputs ...string) float64 {
+	runes := []rune(password)
+	if len(runes) == 0 {
+		return 1
+	}
+	return minimumGuesses(runes, findMatches(runes, dictionary(userInputs)))
+}
+
+// dictionary is the common passwords plus the user's own details, which
+// rank first since an attacker targeting one account would try them first.
+func dictionary(userInputs []string) map[string]int {
+	words := map[string]int{}
+	for word, rank := range commonPasswords() {
+		words[word] = rank
+	}
+
+	rank := 1
+	for _, input := range userInputs {
+		for _, word := range strings.FieldsFunc(strings.ToLower(input), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) {
+			if len([]rune(word)) >= 3 {
+				words[word] = rank
+				rank++
+			}
+		}
+	}
+	return words
+}
+
+// minimumGuesses finds the cheapest cover of runes by matches and brute
+// force. Covering with l patterns whose guesses multiply to p costs
+// l! * p, since the attacker doesn't know which order they come in, plus
+// minGuessesPerPattern^(l-1).
+func minimumGuesses(runes []rune, matches []match) float64 {
+	n := len(runes)
+
+	byEnd := make([][]match, n)
+	for _, m := range matches {
+		byEnd[m.j] = append(byEnd[m.j], m)
+	}
+
+	// best[k][l] is the smallest product of guesses covering runes[:k+1]
+	// with l patterns.
+	best := make([][]float64, n)
+	for k := range n {
+		best[k] = make([]float64, k+2)
+		for l := range best[k] {
+			best[k][l] = math.Inf(1)
+		}
+
+		candidates := byEnd[k]
+		for i := 0; i <= k; i++ {
+			candidates = append(candidates, match{i: i, j: k, guesses: bruteforceGuesses(k - i + 1)})
+		}
+
+		for _, m := range candidates {
+			if m.i == 0 {
+				best[k][1] = min(best[k][1], m.guesses)
+				continue
+			}
+			for l, product := range best[m.i-1] {
+				best[k][l+1] = min(best[k][l+1], product*m.guesses)
+			}
+		}
+	}
+
+	guesses := math.Inf(1)
+	for l, product := range best[n-1] {
+		if l > 0 && !math.IsInf(product, 1) {
+			guesses = min(guesses, factorial(l)*product+math.Pow(minGuessesPerPattern, float64(l-1)))
+		}
+	}
+	return guesses
+}
+
+func bruteforceGuesses(length int) float64 {
+	guesses := math.Pow(bruteforceCardinality, float64(length))
+	if length == 1 {
+		return max(guesses, minSingleCharGuesses)
+	}
+	return max(guesses, minMultiCharGuesses)
+}
+
+func factorial(n int) float64 {
+	f := 1.0
+	for i := 2; i <= n; i++ {
+		f *= float64(i)
+	}
+	return f
+}
+
+func findMatches(runes []rune, words map[string]int) []match {
+	return append(findBaseMatches(runes, words), repeatMatches(runes, words)...)
+}
+
+// findBaseMatches finds every kind of pattern except repeats, which is all a
+// repeated unit can contain.
+func findBaseMatches(runes []rune, words map[string]int) []match {
+	var matches []match
+	matches = append(matches, dictionaryMatches(runes, words)...)
+	matches = append(matches, keyboardMatches(runes)...)
+	matches = append(matches, sequenceMatches(runes)...)
+	matches = append(matches, yearMatches(runes)...)
+	return matches
+}
+
+// dictionaryMatches finds words, as typed, reversed, or with l33t
+// substitutions like 4 for a and 0 for o.
+func dictionaryMatches(runes []rune, words map[string]int) []match {
+	var matches []match
+	n := len(runes)
+
+	lower := []rune(strings.ToLower(string(runes)))
+	for i := range n {
+		for j := i + 2; j < n; j++ {
+			token := runes[i : j+1]
+			variations := uppercaseVariations(token)
+
+			if rank, ok := words[string(lower[i:j+1])]; ok {
+				matches = append(matches, match{i: i, j: j, guesses: float64(rank) * variations})
+			}
+
+			reversed := reverse(lower[i : j+1])
+			if rank, ok := words[string(reversed)]; ok {
+				matches = append(matches, match{i: i, j: j, guesses: float64(rank) * variations * 2})
+			}
+
+			for _, table := range l33tTables {
+				subbed, subs := unl33t(lower[i:j+1], table)
+				if subs == 0 {
+					continue
+				}
+				if rank, ok := words[string(subbed)]; ok {
+					matches = append(matches, match{i: i, j: j, guesses: float64(rank) * variations * math.Pow(2, float64(subs))})
+				}
+			}
+		}
+	}
+
+	return matches
+}
+
+// uppercaseVariations is how many ways of capitalizing token an attacker
+// tries before this one. Capitalizing the first letter, the last or all of
+// them is so common it only doubles the work.
+func uppercaseVariations(token []rune) float64 {
+	var upper, lower int
+	for _, r := range token {
+		switch {
+		case unicode.IsUpper(r):
+			upper++
+		case unicode.IsLower(r):
+			lower++
+		}
+	}
+
+	switch {
+	case upper == 0:
+		return 1
+	case lower == 0,
+		upper == 1 && unicode.IsUpper(token[0]),
+		upper == 1 && unicode.IsUpper(token[len(token)-1]):
+		return 2
+	}
+
+	variations := 0.0
+	for i := 1; i <= min(upper, lower); i++ {
+		variations += binomial(upper+lower, i)
+	}
+	return variations
+}
+
+func binomial(n, k int) float64 {
+	result := 1.0
+	for i := 1; i <= k; i++ {
+		result = result * float64(n-k+i) / float64(i)
+	}
+	return result
+}
+
+func unl33t(token []rune, table map[rune]rune) ([]rune, int) {
+	subbed := make([]rune, len(token))
+	subs := 0
+	for i, r := range token {
+		if plain, ok := table[r]; ok {
+			subbed[i] = plain
+			subs++
+		} else {
+			subbed[i] = r
+		}
+	}
+	return subbed, subs
+}
+
+func reverse(runes []rune) []rune {
+	reversed := make([]rune, len(runes))
+	for i, r := range runes {
+		reversed[len(runes)-1-i] = r
+	}
+	return reversed
+}
+
+// keyboardMatches finds runs of three or more neighbouring keys along a
+// keyboard row, like qwerty or 7654.
+func keyboardMatches(runes []rune) []match {
+	var matches []match
+	lower := []rune(strings.ToLower(string(runes)))
+
+	for i := range lower {
+		for _, row := range keyboardRows {
+			start := strings.IndexRune(row, lower[i])
+			if start < 0 {
+				continue
+			}
+			for _, step := range []int{1, -1} {
+				pos := start
+				for j := i + 1; j < len(lower); j++ {
+					pos += step
+					if pos < 0 || pos >= len(row) || rune(row[pos]) != lower[j] {
+						break
+					}
+					if j-i+1 < 3 {
+						continue
+					}
+					guesses := float64(keyboardStarts * keyboardDegree * (j - i))
+					if uppercaseVariations(runes[i:j+1]) > 1 {
+						guesses *= 2
+					}
+					matches = append(matches, match{i: i, j: j, guesses: guesses})
+				}
+			}
+		}
+	}
+
+	return matches
+}
+
+// sequenceMatches finds runs of three or more characters with a steady,
+// small step between them, like abc, 97531 or zyx.
+func sequenceMatches(runes []rune) []match {
+	var matches []match
+
+	for i := 0; i+2 < len(runes); i++ {
+		delta := runes[i+1] - runes[i]
+		if delta == 0 || delta > 5 || delta < -5 {
+			continue
+		}
+		for j := i + 2; j < len(runes) && runes[j]-runes[j-1] == delta; j++ {
+			var base float64
+			switch first := runes[i]; {
+			case strings.ContainsRune("aAzZ019", first):
+				base = 4
+			case unicode.IsDigit(first):
+				base = 10
+			case unicode.IsLower(first):
+				base = 26
+			default:
+				base = 52
+			}
+			if delta < 0 {
+				base *= 2
+			}
+			matches = append(matches, match{i: i, j: j, guesses: base * float64(j-i+1)})
+		}
+	}
+
+	return matches
+}
+
+// repeatMatches finds a run of characters repeated back to back, like aaaa
+// or abcabc. Repeating costs little more than guessing what is repeated.
+func repeatMatches(runes []rune, words map[string]int) []match {
+	var matches []match
+	n := len(runes)
+
+	// The same unit shows up at many offsets in something like abababab.
+	unitGuesses := map[string]float64{}
+
+	for i := range n {
+		// The shortest unit that repeats here is the one an attacker would
+		// guess; longer ones are just it repeated.
+		for unit := 1; i+2*unit <= n; unit++ {
+			count := 1
+			for i+(count+1)*unit <= n && string(runes[i+count*unit:i+(count+1)*unit]) == string(runes[i:i+unit]) {
+				count++
+			}
+			if count < 2 {
+				continue
+			}
+			if count*unit < 3 {
+				continue
+			}
+
+			base := runes[i : i+unit]
+			baseGuesses, ok := unitGuesses[string(base)]
+			if !ok {
+				baseGuesses = minimumGuesses(base, findBaseMatches(base, words))
+				unitGuesses[string(base)] = baseGuesses
+			}
+			matches = append(matches, match{i: i, j: i + count*unit - 1, guesses: baseGuesses * float64(count)})
+			break
+		}
+	}
+
+	return matches
+}
+
+// yearMatches finds years from 1900 to 2099, which cost less to guess the
+// nearer they are to now.
+func yearMatches(runes []rune) []match {
+	var matches []match
+	now := time.Now().Year()
+
+	for i := 0; i+4 <= len(runes); i++ {
+		year, err := strconv.Atoi(string(runes[i : i+4]))
+		if err != nil || year < 1900 || year > 2099 || !unicode.IsDigit(runes[i]) {
+			continue
+		}
+		space := year - now
+		if space < 0 {
+			space = -space
+		}
+		matches = append(matches, match{i: i, j: i + 3, guesses: float64(max(space, minYearSpace))})
+	}
+
+	return matches
+}
@@ -0,0 +1,233 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+	"github.com/airlangga-hub/chirpy-go/internal/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const (
+	notifyChannel = "chirpy_events"
+
+	// Postgres rejects NOTIFY payloads of 8000 bytes or more. Anything
+	// bigger is parked in event_payloads and only its ID is sent.
+	maxNotifyPayload = 7900
+
+	payloadRetention = 5 * time.Minute
+	listenerPingInterval = 90 * time.Second
+	notifyTimeout = 5 * time.Second
+
+	// outboxSize is how many events can wait to be relayed before Publish
+	// starts dropping them for other instances.
+	outboxSize = 1024
+)
+
+type envelope struct {
+	Origin    string    `json:"origin"`
+	Event     *Event    `json:"event,omitempty"`
+	PayloadID uuid.UUID `json:"payload_id,omitzero"`
+}
+
+// eventStore is the part of the database the bridge needs.
+type eventStore interface {
+	CreateEventPayload(ctx context.Context, payload string) (uuid.UUID, error)
+	GetEventPayload(ctx context.Context, id uuid.UUID) (string, error)
+	DeleteEventPayloadsBefore(ctx context.Context, createdAt time.Time) error
+	NotifyEvent(ctx context.Context, arg database.NotifyEventParams) error
+}
+
+// PGBridge publishes events to the local hub and relays them to every other
+// instance through Postgres LISTEN/NOTIFY.
+type PGBridge struct {
+	hub      *Hub
+	db       eventStore
+	listener *pq.Listener
+	origin   string
+	outbox   chan Event
+	done     chan struct{}
+}
+
+func NewPGBridge(dbURL string, db *database.Queries, hub *Hub) (*PGBridge, error) {
+	listener := pq.NewListener(dbURL, 10*time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		switch ev {
+		case pq.ListenerEventDisconnected:
+			log.Printf("Event bridge disconnected from Postgres: %s", err)
+		case pq.ListenerEventReconnected:
+			log.Println("Event bridge reconnected to Postgres")
+		case pq.ListenerEventConnectionAttemptFailed:
+			log.Printf("Event bridge couldn't reconnect to Postgres: %s", err)
+		}
+	})
+
+	if err := listener.Listen(notifyChannel); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	b := &PGBridge{
+		hub: hub,
+		db: db,
+		listener: listener,
+		origin: uuid.NewString(),
+		outbox: make(chan Event, outboxSize),
+		done: make(chan struct{}),
+	}
+
+	go b.run()
+	go b.relay()
+
+	return b, nil
+}
+
+// Publish delivers event to local subscribers right away and queues it for
+// the other instances, so callers never wait on the database. If the queue is
+// full, other instances miss the event, just as slow subscribers do.
+func (b *PGBridge) Publish(event Event) {
+	b.hub.Publish(event)
+
+	select {
+	case b.outbox <- event:
+	default:
+		log.Printf("Event bridge outbox full, dropping %s event for %s", event.Type, event.Topic)
+	}
+}
+
+func (b *PGBridge) relay() {
+	for {
+		select {
+		case <-b.done:
+			return
+		case event := <-b.outbox:
+			b.notify(event)
+		}
+	}
+}
+
+func (b *PGBridge) notify(event Event) {
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+
+	payload, err := b.encode(ctx, event)
+	if err != nil {
+		log.Printf("Error encoding event for bridge: %s", err)
+		return
+	}
+
+	if err := b.db.NotifyEvent(ctx, database.NotifyEventParams{
+		Channel: notifyChannel,
+		Payload: payload,
+	}); err != nil {
+		log.Printf("Error sending event notification: %s", err)
+	}
+}
+
+// encode wraps event in an envelope for NOTIFY. One too big for a
+// notification is stored in event_payloads and only its ID is sent.
+func (b *PGBridge) encode(ctx context.Context, event Event) (string, error) {
+	payload, err := json.Marshal(envelope{Origin: b.origin, Event: &event})
+	if err != nil {
+		return "", err
+	}
+
+	if len(payload) > maxNotifyPayload {
+		payloadID, err := b.db.CreateEventPayload(ctx, string(payload))
+		if err != nil {
+			return "", err
+		}
+
+		payload, err = json.Marshal(envelope{Origin: b.origin, PayloadID: payloadID})
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return string(payload), nil
+}
+
+func (b *PGBridge) Close() error {
+	close(b.done)
+	return b.listener.Close()
+}
+
+func (b *PGBridge) run() {
+	ping := time.NewTicker(listenerPingInterval)
+	defer ping.Stop()
+
+	cleanup := time.NewTicker(payloadRetention)
+	defer cleanup.Stop()
+
+	for {
+		select {
+		case <-b.done:
+			return
+
+		case notification, ok := <-b.listener.Notify:
+			if !ok {
+				return
+			}
+			// A nil notification means the connection was re-established
+			// and anything sent while it was down has been lost.
+			if notification == nil {
+				continue
+			}
+			b.receive(notification.Extra)
+
+		case <-ping.C:
+			go b.listener.Ping()
+
+		case <-cleanup.C:
+			ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+			if err := b.db.DeleteEventPayloadsBefore(ctx, time.Now().UTC().Add(-payloadRetention)); err != nil {
+				log.Printf("Error deleting old event payloads: %s", err)
+			}
+			cancel()
+		}
+	}
+}
+
+func (b *PGBridge) receive(payload string) {
+	event, err := b.decode(payload)
+	if err != nil {
+		log.Printf("Error decoding event notification: %s", err)
+		return
+	}
+	if event == nil {
+		return
+	}
+
+	b.hub.Publish(*event)
+}
+
+// decode unwraps a notification, loading a stored payload if that's all it
+// carries. It returns nil for this instance's own events, which were
+// published locally already.
+func (b *PGBridge) decode(payload string) (*Event, error) {
+	var env envelope
+	if err := json.Unmarshal([]byte(payload), &env); err != nil {
+		return nil, err
+	}
+	if env.Origin == b.origin {
+		return nil, nil
+	}
+
+	if env.PayloadID != uuid.Nil {
+		ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+		defer cancel()
+
+		stored, err := b.db.GetEventPayload(ctx, env.PayloadID)
+		if err != nil {
+			return nil, fmt.Errorf("Couldn't load large event payload %s: %w", env.PayloadID, err)
+		}
+		env = envelope{}
+		if err := json.Unmarshal([]byte(stored), &env); err != nil {
+			return nil, err
+		}
+	}
+
+	return env.Event, nil
+}
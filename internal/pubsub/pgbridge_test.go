@@ -0,0 +1,160 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"github.com/airlangga-hub/chirpy-go/internal/database"
+	"github.com/google/uuid"
+)
+
+type memoryEventStore struct {
+	mu       sync.Mutex
+	payloads map[uuid.UUID]string
+	notified chan string
+}
+
+func newMemoryEventStore() *memoryEventStore {
+	return &memoryEventStore{
+		payloads: map[uuid.UUID]string{},
+		notified: make(chan string, 10),
+	}
+}
+
+func (s *memoryEventStore) CreateEventPayload(ctx context.Context, payload string) (uuid.UUID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := uuid.New()
+	s.payloads[id] = payload
+	return id, nil
+}
+
+func (s *memoryEventStore) GetEventPayload(ctx context.Context, id uuid.UUID) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.payloads[id], nil
+}
+
+func (s *memoryEventStore) DeleteEventPayloadsBefore(ctx context.Context, createdAt time.Time) error {
+	return nil
+}
+
+func (s *memoryEventStore) NotifyEvent(ctx context.Context, arg database.NotifyEventParams) error {
+	s.notified <- arg.Payload
+	return nil
+}
+
+func newTestBridge(store eventStore) *PGBridge {
+	return &PGBridge{
+		hub: NewHub(),
+		db: store,
+		origin: uuid.NewString(),
+		outbox: make(chan Event, outboxSize),
+		done: make(chan struct{}),
+	}
+}
+
+func TestPGBridgeEnvelope(t *testing.T) {
+	store := newMemoryEventStore()
+	sender := newTestBridge(store)
+	receiver := newTestBridge(store)
+
+	small, _ := NewEvent("timeline", "chirp.created", map[string]string{"body": "hello"})
+	large, _ := NewEvent("timeline", "chirp.created", map[string]string{"body": strings.Repeat("a", 2*maxNotifyPayload)})
+
+	tests := []struct {
+		name       string
+		event      Event
+		wantStored bool
+	}{
+		{name: "Small event sent inline", event: small, wantStored: false},
+		{name: "Large event stored and sent by ID", event: large, wantStored: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := sender.encode(context.Background(), tt.event)
+			if err != nil {
+				t.Fatalf("encode() error = %v", err)
+			}
+			if len(payload) > maxNotifyPayload {
+				t.Errorf("encode() payload is %d bytes, want at most %d", len(payload), maxNotifyPayload)
+			}
+
+			var env envelope
+			if err := json.Unmarshal([]byte(payload), &env); err != nil {
+				t.Fatalf("encode() payload isn't JSON: %v", err)
+			}
+			if env.Origin != sender.origin {
+				t.Errorf("envelope origin = %q, want %q", env.Origin, sender.origin)
+			}
+			if stored := env.PayloadID != uuid.Nil; stored != tt.wantStored {
+				t.Errorf("stored = %v, want %v", stored, tt.wantStored)
+			}
+			if tt.wantStored && env.Event != nil {
+				t.Errorf("envelope for a stored payload carries the event too")
+			}
+
+			got, err := receiver.decode(payload)
+			if err != nil {
+				t.Fatalf("decode() error = %v", err)
+			}
+			if got == nil || got.Topic != tt.event.Topic || got.Type != tt.event.Type || string(got.Data) != string(tt.event.Data) {
+				t.Errorf("decode() = %+v, want %+v", got, tt.event)
+			}
+
+			own, err := sender.decode(payload)
+			if err != nil {
+				t.Fatalf("decode() own event error = %v", err)
+			}
+			if own != nil {
+				t.Errorf("decode() own event = %+v, want nil", own)
+			}
+		})
+	}
+}
+
+func TestPGBridgePublish(t *testing.T) {
+	// Publish reaches local subscribers at once and leaves NOTIFY to the
+	// relay goroutine.
+	store := newMemoryEventStore()
+	bridge := newTestBridge(store)
+
+	sub := bridge.hub.Subscribe()
+	defer sub.Close()
+	sub.Add("timeline")
+
+	event, _ := NewEvent("timeline", "chirp.created", map[string]string{"body": "hello"})
+	bridge.Publish(event)
+
+	select {
+	case got := <-sub.Events():
+		if got.Type != event.Type {
+			t.Errorf("local event type = %q, want %q", got.Type, event.Type)
+		}
+	default:
+		t.Fatal("Publish() didn't deliver the event locally")
+	}
+
+	select {
+	case payload := <-store.notified:
+		t.Fatalf("Publish() sent NOTIFY %s itself", payload)
+	default:
+	}
+
+	go bridge.relay()
+	defer close(bridge.done)
+
+	select {
+	case payload := <-store.notified:
+		got, err := newTestBridge(store).decode(payload)
+		if err != nil || got == nil || got.Type != event.Type {
+			t.Errorf("relayed payload decodes to %+v, %v", got, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("relay didn't send the queued event")
+	}
+}
@@ -0,0 +1,130 @@
+package pubsub
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+const subscriptionBuffer = 64
+
+type Event struct {
+	Topic string          `json:"topic"`
+	Type  string          `json:"type"`
+	Data  json.RawMessage `json:"data"`
+}
+
+type Publisher interface {
+	Publish(event Event)
+}
+
+type Hub struct {
+	mu   sync.RWMutex
+	subs map[string]map[*Subscription]struct{}
+}
+
+type Subscription struct {
+	hub    *Hub
+	events chan Event
+	mu     sync.Mutex
+	topics map[string]struct{}
+	closed bool
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		subs: map[string]map[*Subscription]struct{}{},
+	}
+}
+
+func NewEvent(topic, eventType string, data any) (Event, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{Topic: topic, Type: eventType, Data: raw}, nil
+}
+
+// Publish delivers the event to every subscription of its topic. Slow
+// subscribers whose buffers are full miss the event instead of blocking.
+func (h *Hub) Publish(event Event) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for sub := range h.subs[event.Topic] {
+		select {
+		case sub.events <- event:
+		default:
+		}
+	}
+}
+
+func (h *Hub) Subscribe() *Subscription {
+	return &Subscription{
+		hub:    h,
+		events: make(chan Event, subscriptionBuffer),
+		topics: map[string]struct{}{},
+	}
+}
+
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+func (s *Subscription) Add(topic string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+	s.topics[topic] = struct{}{}
+
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	if s.hub.subs[topic] == nil {
+		s.hub.subs[topic] = map[*Subscription]struct{}{}
+	}
+	s.hub.subs[topic][s] = struct{}{}
+}
+
+func (s *Subscription) Remove(topic string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.topics, topic)
+	s.hub.remove(topic, s)
+}
+
+func (s *Subscription) Has(topic string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.topics[topic]
+	return ok
+}
+
+func (s *Subscription) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+	s.closed = true
+
+	for topic := range s.topics {
+		s.hub.remove(topic, s)
+	}
+	s.topics = nil
+}
+
+func (h *Hub) remove(topic string, sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.subs[topic], sub)
+	if len(h.subs[topic]) == 0 {
+		delete(h.subs, topic)
+	}
+}
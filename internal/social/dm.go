@@ -0,0 +1,31 @@
+package social
+
+import "errors"
+
+// DM policies say who may start a conversation with a user or message them
+// in one.
+const (
+	DMEveryone = "everyone"
+	DMFollowing = "following"
+)
+
+var errInvalidDMPolicy = errors.New("DM policy must be everyone or following")
+
+func ValidateDMPolicy(policy string) error {
+	if policy != DMEveryone && policy != DMFollowing {
+		return errInvalidDMPolicy
+	}
+	return nil
+}
+
+// AcceptsDM reports whether a recipient with policy takes direct messages
+// from a sender, given whether the recipient follows the sender.
+func AcceptsDM(policy string, followsSender bool) bool {
+	switch policy {
+	case DMEveryone:
+		return true
+	case DMFollowing:
+		return followsSender
+	}
+	return false
+}
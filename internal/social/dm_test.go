@@ -0,0 +1,46 @@
+package social
+
+import "testing"
+
+func TestAcceptsDM(t *testing.T) {
+	tests := []struct {
+		name          string
+		policy        string
+		followsSender bool
+		want          bool
+	}{
+		{name: "Everyone, not following", policy: DMEveryone, followsSender: false, want: true},
+		{name: "Everyone, following", policy: DMEveryone, followsSender: true, want: true},
+		{name: "Following, not following the sender", policy: DMFollowing, followsSender: false, want: false},
+		{name: "Following, following the sender", policy: DMFollowing, followsSender: true, want: true},
+		{name: "Unknown policy", policy: "nobody", followsSender: true, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AcceptsDM(tt.policy, tt.followsSender); got != tt.want {
+				t.Errorf("AcceptsDM(%q, %v) = %v, want %v", tt.policy, tt.followsSender, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateDMPolicy(t *testing.T) {
+	tests := []struct {
+		policy  string
+		wantErr bool
+	}{
+		{policy: DMEveryone, wantErr: false},
+		{policy: DMFollowing, wantErr: false},
+		{policy: "", wantErr: true},
+		{policy: "Everyone", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			if err := ValidateDMPolicy(tt.policy); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateDMPolicy(%q) error = %v, wantErr %v", tt.policy, err, tt.wantErr)
+			}
+		})
+	}
+}
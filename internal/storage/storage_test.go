@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalStorageHandler(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewLocalStorage(dir, "/uploads")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Put(context.Background(), "avatars/user/large.png", strings.NewReader("image")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "avatars", ".upload-123"), []byte("partial"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := http.StripPrefix("/uploads", store.Handler())
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+	}{
+		{name: "File", path: "/uploads/avatars/user/large.png", wantStatus: http.StatusOK},
+		{name: "Root directory", path: "/uploads/", wantStatus: http.StatusNotFound},
+		{name: "Nested directory", path: "/uploads/avatars/user/", wantStatus: http.StatusNotFound},
+		{name: "Directory without slash", path: "/uploads/avatars", wantStatus: http.StatusNotFound},
+		{name: "Upload in progress", path: "/uploads/avatars/.upload-123", wantStatus: http.StatusNotFound},
+		{name: "Missing file", path: "/uploads/avatars/user/small.png", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("GET %s status = %d, want %d", tt.path, rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,320 @@
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	OpContinuation = 0x0
+	OpText         = 0x1
+	OpBinary       = 0x2
+	OpClose        = 0x8
+	OpPing         = 0x9
+	OpPong         = 0xA
+)
+
+const (
+	CloseNormal          = 1000
+	CloseGoingAway       = 1001
+	CloseProtocolError   = 1002
+	CloseUnsupportedData = 1003
+	CloseNoStatus        = 1005
+	CloseMessageTooBig   = 1009
+	CloseInternalError   = 1011
+)
+
+const MaxMessageSize = 64 * 1024
+
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("websocket closed: %d %s", e.Code, e.Reason)
+}
+
+type Conn struct {
+	conn    net.Conn
+	rw      *bufio.ReadWriter
+	writeMu sync.Mutex
+	closed  bool
+	onPong  func()
+}
+
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	if r.Method != http.MethodGet {
+		return nil, errors.New("Websocket upgrade requires GET")
+	}
+	if !headerContainsToken(r.Header, "Connection", "upgrade") {
+		return nil, errors.New("Missing Connection: upgrade header")
+	}
+	if !headerContainsToken(r.Header, "Upgrade", "websocket") {
+		return nil, errors.New("Missing Upgrade: websocket header")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		return nil, errors.New("Unsupported websocket version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		return nil, errors.New("Missing Sec-WebSocket-Key header")
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, errors.New("Response writer doesn't support hijacking")
+	}
+
+	netConn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + AcceptKey(key) + "\r\n\r\n"
+
+	if _, err := rw.WriteString(response); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	if err := rw.Flush(); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+
+	return &Conn{conn: netConn, rw: rw}, nil
+}
+
+func AcceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func headerContainsToken(headers http.Header, name, token string) bool {
+	for _, value := range headers.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ReadMessage returns the next text or binary message. Pings are answered
+// and pongs are passed to the SetPongHandler function; a close frame is
+// echoed and returned as *CloseError.
+func (c *Conn) ReadMessage() (int, []byte, error) {
+	var (
+		messageType int
+		message     []byte
+	)
+
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch opcode {
+		case OpPing:
+			if err := c.WriteMessage(OpPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case OpPong:
+			if c.onPong != nil {
+				c.onPong()
+			}
+			continue
+		case OpClose:
+			closeErr := &CloseError{Code: CloseNoStatus}
+			if len(payload) >= 2 {
+				closeErr.Code = int(binary.BigEndian.Uint16(payload))
+				closeErr.Reason = string(payload[2:])
+			}
+			c.WriteClose(closeErr.Code, "")
+			return 0, nil, closeErr
+		case OpText, OpBinary:
+			if messageType != 0 {
+				c.WriteClose(CloseProtocolError, "Expected continuation frame")
+				return 0, nil, errors.New("Expected continuation frame")
+			}
+			messageType = opcode
+		case OpContinuation:
+			if messageType == 0 {
+				c.WriteClose(CloseProtocolError, "Unexpected continuation frame")
+				return 0, nil, errors.New("Unexpected continuation frame")
+			}
+		default:
+			c.WriteClose(CloseProtocolError, "Unknown opcode")
+			return 0, nil, fmt.Errorf("Unknown opcode: %d", opcode)
+		}
+
+		if len(message)+len(payload) > MaxMessageSize {
+			c.WriteClose(CloseMessageTooBig, "Message too big")
+			return 0, nil, errors.New("Message too big")
+		}
+		message = append(message, payload...)
+
+		if fin {
+			return messageType, message, nil
+		}
+	}
+}
+
+func (c *Conn) readFrame() (bool, int, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.rw, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	fin := header[0]&0x80 != 0
+	opcode := int(header[0] & 0x0F)
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7F)
+
+	if header[0]&0x70 != 0 {
+		c.WriteClose(CloseProtocolError, "Reserved bits set")
+		return false, 0, nil, errors.New("Reserved bits set")
+	}
+	if !masked {
+		c.WriteClose(CloseProtocolError, "Client frames must be masked")
+		return false, 0, nil, errors.New("Client frame not masked")
+	}
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.rw, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.rw, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+
+	if opcode >= OpClose && (length > 125 || !fin) {
+		c.WriteClose(CloseProtocolError, "Invalid control frame")
+		return false, 0, nil, errors.New("Invalid control frame")
+	}
+	if length > MaxMessageSize {
+		c.WriteClose(CloseMessageTooBig, "Message too big")
+		return false, 0, nil, errors.New("Message too big")
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.rw, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.rw, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return fin, opcode, payload, nil
+}
+
+func (c *Conn) WriteMessage(opcode int, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.closed {
+		return errors.New("Websocket connection is closed")
+	}
+
+	return c.writeFrame(opcode, payload)
+}
+
+func (c *Conn) writeFrame(opcode int, payload []byte) error {
+	header := []byte{0x80 | byte(opcode)}
+
+	length := len(payload)
+	switch {
+	case length <= 125:
+		header = append(header, byte(length))
+	case length <= 0xFFFF:
+		header = append(header, 126)
+		header = binary.BigEndian.AppendUint16(header, uint16(length))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(length))
+	}
+
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+
+	if _, err := c.rw.Write(header); err != nil {
+		return err
+	}
+	if _, err := c.rw.Write(payload); err != nil {
+		return err
+	}
+	return c.rw.Flush()
+}
+
+func (c *Conn) WriteJSON(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.WriteMessage(OpText, data)
+}
+
+// WriteClose sends a close frame. Any later writes fail, but the underlying
+// connection stays open until Close is called.
+func (c *Conn) WriteClose(code int, reason string) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+	payload = append(payload, reason...)
+
+	return c.writeFrame(OpClose, payload)
+}
+
+// SetPongHandler sets a function ReadMessage calls, on the reading
+// goroutine, for every pong it receives. Call it before reading starts.
+func (c *Conn) SetPongHandler(h func()) {
+	c.onPong = h
+}
+
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,172 @@
+package websocket
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAcceptKey(t *testing.T) {
+	// Example from RFC 6455 section 1.3
+	got := AcceptKey("dGhlIHNhbXBsZSBub25jZQ==")
+	want := "s3pPLMBiTxaQ9kYGzzhZRbK+xOo="
+	if got != want {
+		t.Errorf("AcceptKey() = %v, want %v", got, want)
+	}
+}
+
+func writeClientFrame(conn net.Conn, opcode int, payload []byte) error {
+	mask := [4]byte{1, 2, 3, 4}
+	frame := []byte{0x80 | byte(opcode), 0x80 | byte(len(payload))}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	_, err := conn.Write(frame)
+	return err
+}
+
+func readServerFrame(r *bufio.Reader) (int, []byte, error) {
+	var header [2]byte
+	if _, err := r.Read(header[:1]); err != nil {
+		return 0, nil, err
+	}
+	if _, err := r.Read(header[1:]); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, header[1]&0x7F)
+	for read := 0; read < len(payload); {
+		n, err := r.Read(payload[read:])
+		if err != nil {
+			return 0, nil, err
+		}
+		read += n
+	}
+	return int(header[0] & 0x0F), payload, nil
+}
+
+// dialTestServer starts handler and completes a websocket handshake with it.
+func dialTestServer(t *testing.T, handler func(conn *Conn)) (net.Conn, *bufio.Reader) {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			t.Errorf("Upgrade() error = %v", err)
+			return
+		}
+		defer conn.Close()
+		handler(conn)
+	}))
+	t.Cleanup(server.Close)
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	conn.Write([]byte("GET / HTTP/1.1\r\n" +
+		"Host: example.com\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: keep-alive, Upgrade\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n" +
+		"Sec-WebSocket-Version: 13\r\n\r\n"))
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("handshake status = %d, want 101", resp.StatusCode)
+	}
+
+	return conn, reader
+}
+
+func TestEcho(t *testing.T) {
+	conn, reader := dialTestServer(t, func(conn *Conn) {
+		for {
+			messageType, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteMessage(messageType, data)
+		}
+	})
+
+	tests := []struct {
+		name       string
+		opcode     int
+		payload    string
+		wantOpcode int
+	}{
+		{name: "Text message echoed", opcode: OpText, payload: "hello", wantOpcode: OpText},
+		{name: "Ping answered with pong", opcode: OpPing, payload: "beat", wantOpcode: OpPong},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := writeClientFrame(conn, tt.opcode, []byte(tt.payload)); err != nil {
+				t.Fatal(err)
+			}
+			opcode, payload, err := readServerFrame(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if opcode != tt.wantOpcode || string(payload) != tt.payload {
+				t.Errorf("got opcode %d payload %q, want opcode %d payload %q", opcode, payload, tt.wantOpcode, tt.payload)
+			}
+		})
+	}
+
+	closePayload := binary.BigEndian.AppendUint16(nil, CloseNormal)
+	writeClientFrame(conn, OpClose, closePayload)
+	opcode, payload, err := readServerFrame(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opcode != OpClose || binary.BigEndian.Uint16(payload) != CloseNormal {
+		t.Errorf("got opcode %d payload %v, want close %d", opcode, payload, CloseNormal)
+	}
+}
+
+func TestPongDeadline(t *testing.T) {
+	// The server drops a peer that stops answering pings: each pong pushes
+	// the read deadline back, and without one the read times out.
+	const pongWait = 200 * time.Millisecond
+
+	readErr := make(chan error, 1)
+	conn, _ := dialTestServer(t, func(conn *Conn) {
+		conn.SetReadDeadline(time.Now().Add(pongWait))
+		conn.SetPongHandler(func() {
+			conn.SetReadDeadline(time.Now().Add(pongWait))
+		})
+		_, _, err := conn.ReadMessage()
+		readErr <- err
+	})
+
+	start := time.Now()
+	for range 4 {
+		time.Sleep(pongWait / 2)
+		if err := writeClientFrame(conn, OpPong, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := <-readErr
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("ReadMessage() error = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed < 2*pongWait+pongWait/2 {
+		t.Errorf("read timed out after %v, before the pongs stopped", elapsed)
+	}
+}
@@ -33,4 +33,26 @@ func respondWithError(w http.ResponseWriter, code int, msg string, err error) {
 	}
 
 	respondWithJSON(w, code, errorResponse{Error: msg})
+}
+
+// fieldError explains why one request field was refused. Code is stable for
+// clients to match on; Message is for people.
+type fieldError struct {
+	Field string `json:"field"`
+	Code string `json:"code"`
+	Message string `json:"message"`
+}
+
+// respondWithFieldErrors answers 400 with every invalid field. error holds
+// the first message, for clients that only show one.
+func respondWithFieldErrors(w http.ResponseWriter, errs []fieldError) {
+	type errorResponse struct {
+		Error string `json:"error"`
+		Fields []fieldError `json:"fields"`
+	}
+
+	respondWithJSON(w, http.StatusBadRequest, errorResponse{
+		Error: errs[0].Message,
+		Fields: errs,
+	})
 }
\ No newline at end of file
@@ -1,22 +1,42 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"sync/atomic"
 	"database/sql"
 	"os"
+	"strconv"
+	"strings"
 	"github.com/joho/godotenv"
+	"github.com/airlangga-hub/chirpy-go/internal/auth"
 	"github.com/airlangga-hub/chirpy-go/internal/database"
+	"github.com/airlangga-hub/chirpy-go/internal/mailer"
+	"github.com/airlangga-hub/chirpy-go/internal/oauth"
+	"github.com/airlangga-hub/chirpy-go/internal/oidc"
+	"github.com/airlangga-hub/chirpy-go/internal/password"
+	"github.com/airlangga-hub/chirpy-go/internal/pubsub"
+	"github.com/airlangga-hub/chirpy-go/internal/storage"
 	_ "github.com/lib/pq"
 )
 
 type apiConfig struct {
 	fileserverHits 	atomic.Int32
 	db 				*database.Queries
+	dbConn			*sql.DB
 	platform		string
-	jwtSecret		string
+	jwtKeys			*auth.KeySet
 	polkaKey		string
+	hub				*pubsub.Hub
+	publisher		pubsub.Publisher
+	storage			storage.Storage
+	mailer			mailer.Mailer
+	publicURL		string
+	revocations		auth.RevocationStore
+	oauth			*oauth.Server
+	oidcProviders	map[string]*oidc.Provider
+	passwordPolicy	password.Policy
 }
 
 func main() {
@@ -28,8 +48,18 @@ func main() {
 	godotenv.Load()
 
 	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		log.Fatal("JWT_SECRET must be set")
+	jwtKeysDir := os.Getenv("JWT_KEYS_DIR")
+	if jwtSecret == "" && jwtKeysDir == "" {
+		log.Fatal("JWT_SECRET or JWT_KEYS_DIR must be set")
+	}
+
+	jwtKeys := auth.NewKeySet(jwtSecret)
+	if jwtKeysDir != "" {
+		var err error
+		jwtKeys, err = auth.LoadKeySet(jwtKeysDir, os.Getenv("JWT_KEY_ID"), jwtSecret)
+		if err != nil {
+			log.Fatalf("Error loading JWT signing keys: %s", err)
+		}
 	}
 
 	polkaKey := os.Getenv("POLKA_KEY")
@@ -54,38 +84,257 @@ func main() {
 		log.Fatal("PLATFORM must be set")
 	}
 
+	uploadsDir := os.Getenv("UPLOADS_DIR")
+	if uploadsDir == "" {
+		uploadsDir = "uploads"
+	}
+
+	fileStorage, err := storage.NewLocalStorage(uploadsDir, "/uploads")
+	if err != nil {
+		log.Fatalf("Error opening upload storage: %s", err)
+	}
+
+	publicURL := os.Getenv("PUBLIC_URL")
+	if publicURL == "" {
+		publicURL = "http://localhost:" + port
+	}
+
+	mailFrom := os.Getenv("MAIL_FROM")
+	if mailFrom == "" {
+		mailFrom = "Chirpy <no-reply@chirpy.local>"
+	}
+
+	var mail mailer.Mailer
+	switch os.Getenv("MAILER") {
+	case "smtp":
+		smtpAddr := os.Getenv("SMTP_ADDR")
+		if smtpAddr == "" {
+			log.Fatal("SMTP_ADDR must be set when MAILER=smtp")
+		}
+		mail = &mailer.SMTPMailer{
+			Addr: smtpAddr,
+			From: mailFrom,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+		}
+	case "file":
+		mailDir := os.Getenv("MAIL_DIR")
+		if mailDir == "" {
+			mailDir = "mail"
+		}
+		mail = &mailer.FileMailer{Dir: mailDir, From: mailFrom}
+	case "", "log":
+		mail = mailer.LogMailer{}
+	default:
+		log.Fatal("MAILER must be one of smtp, file or log")
+	}
+
+	var revocations auth.RevocationStore
+	switch os.Getenv("REVOCATION_STORE") {
+	case "", "postgres":
+		revocations = auth.NewPGRevocationStore(dbQueries)
+	case "memory":
+		revocations = auth.NewMemoryRevocationStore()
+	default:
+		log.Fatal("REVOCATION_STORE must be one of postgres or memory")
+	}
+
+	uintEnv := func(name string, fallback uint64, bits int) uint64 {
+		value := os.Getenv(name)
+		if value == "" {
+			return fallback
+		}
+		n, err := strconv.ParseUint(value, 10, bits)
+		if err != nil {
+			log.Fatalf("%s must be a positive integer", name)
+		}
+		return n
+	}
+	// ARGON2_MEMORY (KiB), ARGON2_ITERATIONS and ARGON2_PARALLELISM raise the
+	// cost of new password hashes. Older hashes are upgraded at login.
+	passwordParams, err := auth.NewPasswordParams(
+		uint32(uintEnv("ARGON2_MEMORY", uint64(auth.PasswordParams.Memory), 32)),
+		uint32(uintEnv("ARGON2_ITERATIONS", uint64(auth.PasswordParams.Iterations), 32)),
+		uint8(uintEnv("ARGON2_PARALLELISM", uint64(auth.PasswordParams.Parallelism), 8)),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	auth.PasswordParams = passwordParams
+
+	passwordPolicy := password.Policy{
+		MinLength: int(uintEnv("PASSWORD_MIN_LENGTH", uint64(password.DefaultPolicy.MinLength), 16)),
+		MinScore: int(uintEnv("PASSWORD_MIN_SCORE", uint64(password.DefaultPolicy.MinScore), 8)),
+	}
+	if passwordPolicy.MinScore > 4 {
+		log.Fatal("PASSWORD_MIN_SCORE must be between 0 and 4")
+	}
+	if path := os.Getenv("BREACHED_PASSWORDS_FILE"); path != "" {
+		corpus, err := password.OpenFileCorpus(path)
+		if err != nil {
+			log.Fatalf("Error opening breached password corpus: %s", err)
+		}
+		passwordPolicy.Breached = corpus
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "bootstrap-admin" {
+		if err := runBootstrapAdmin(context.Background(), dbConn, dbQueries, passwordPolicy, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// OIDC_PROVIDERS names the identity providers users can sign in with,
+	// each configured by OIDC_<NAME>_ISSUER, _CLIENT_ID and _CLIENT_SECRET.
+	oidcProviders := map[string]*oidc.Provider{}
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !oidcProviderNamePattern.MatchString(name) {
+			log.Fatalf("OIDC provider name %q must be lowercase letters, digits and dashes", name)
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		issuer := os.Getenv(prefix + "ISSUER")
+		clientID := os.Getenv(prefix + "CLIENT_ID")
+		if issuer == "" || clientID == "" {
+			log.Fatalf("%sISSUER and %sCLIENT_ID must be set", prefix, prefix)
+		}
+
+		oidcProviders[name] = oidc.NewProvider(oidc.Config{
+			Name: name,
+			Issuer: issuer,
+			ClientID: clientID,
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			Scopes: strings.Fields(os.Getenv(prefix + "SCOPES")),
+		})
+	}
+
+	hub := pubsub.NewHub()
+
+	bridge, err := pubsub.NewPGBridge(dbURL, dbQueries, hub)
+	if err != nil {
+		log.Fatalf("Error starting event bridge: %s", err)
+	}
+	defer bridge.Close()
+
 	apiCfg := apiConfig{
 		fileserverHits: atomic.Int32{},
 		db: dbQueries,
+		dbConn: dbConn,
 		platform: platform,
-		jwtSecret: jwtSecret,
+		jwtKeys: jwtKeys,
 		polkaKey: polkaKey,
+		hub: hub,
+		publisher: bridge,
+		storage: fileStorage,
+		mailer: mail,
+		publicURL: publicURL,
+		revocations: revocations,
+		oidcProviders: oidcProviders,
+		passwordPolicy: passwordPolicy,
 	}
+	apiCfg.oauth = oauth.NewServer(oauth.NewPGStore(dbQueries), oauthIssuer{cfg: &apiCfg}, auth.DelegableScopes)
 
 	fsHandler := apiCfg.middlewareMetricsInc(http.StripPrefix("/app", http.FileServer(http.Dir(filepathRoot))))
 
 	mux := http.NewServeMux()
 	mux.Handle("/app/", fsHandler)
+	mux.Handle("GET /uploads/", http.StripPrefix("/uploads", fileStorage.Handler()))
 
 	mux.HandleFunc("GET /api/healthz", handlerReadiness)
+	mux.HandleFunc("GET /.well-known/jwks.json", apiCfg.handlerJWKS)
 
-	mux.HandleFunc("POST /api/chirps", apiCfg.handlerChirpsCreate)
+	mux.HandleFunc("POST /api/chirps", apiCfg.middlewareAuth(apiCfg.handlerChirpsCreate, auth.ScopeChirpsWrite))
 	mux.HandleFunc("GET /api/chirps", apiCfg.handlerChirpsRetrieve)
 	mux.HandleFunc("GET /api/chirps/{chirpID}", apiCfg.handlerChirpGet)
-	mux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCfg.handlerChirpDelete)
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCfg.middlewareAuth(apiCfg.handlerChirpDelete, auth.ScopeChirpsDelete))
 
 	mux.HandleFunc("POST /api/users", apiCfg.handlerUsersCreate)
-	mux.HandleFunc("PUT /api/users", apiCfg.handlerUsersUpdate)
+	mux.HandleFunc("PUT /api/users", apiCfg.middlewareAuth(apiCfg.handlerUsersUpdate, auth.ScopeProfileWrite))
+	mux.HandleFunc("POST /api/users/password", apiCfg.middlewareAuth(apiCfg.handlerUsersPassword, auth.ScopeAccount))
+	mux.HandleFunc("GET /api/users/{handle}", apiCfg.handlerUsersGet)
+	mux.HandleFunc("POST /api/users/verify", apiCfg.handlerUsersVerify)
+	mux.HandleFunc("GET /api/users/verify", apiCfg.handlerUsersVerifyFromEmail)
+	mux.HandleFunc("POST /api/users/verify/resend", apiCfg.middlewareAuth(apiCfg.handlerUsersVerifyResend, auth.ScopeAccount))
+	mux.HandleFunc("PUT /api/users/avatar", apiCfg.middlewareAuth(apiCfg.handlerUsersAvatarUpload, auth.ScopeProfileWrite))
+	mux.HandleFunc("PUT /api/users/banner", apiCfg.middlewareAuth(apiCfg.handlerUsersBannerUpload, auth.ScopeProfileWrite))
 
 	mux.HandleFunc("POST /api/login", apiCfg.handlerLogin)
+	mux.HandleFunc("POST /api/login/mfa", apiCfg.handlerLoginMFA)
+	mux.HandleFunc("POST /api/login/magic", apiCfg.handlerMagicLinkRequest)
+	mux.HandleFunc("POST /api/login/magic/redeem", apiCfg.handlerMagicLinkRedeem)
+	mux.HandleFunc("GET /api/login/magic/redeem", apiCfg.handlerMagicLinkRedeemFromEmail)
+
+	mux.HandleFunc("GET /api/oidc/providers", apiCfg.handlerOIDCProviders)
+	mux.HandleFunc("GET /api/oidc/{provider}/login", apiCfg.handlerOIDCLogin)
+	mux.HandleFunc("GET /api/oidc/{provider}/callback", apiCfg.handlerOIDCCallback)
+
+	mux.HandleFunc("POST /api/mfa/totp/enroll", apiCfg.middlewareAuth(apiCfg.handlerTOTPEnroll, auth.ScopeAccount))
+	mux.HandleFunc("POST /api/mfa/totp/confirm", apiCfg.middlewareAuth(apiCfg.handlerTOTPConfirm, auth.ScopeAccount))
+	mux.HandleFunc("POST /api/mfa/totp/disable", apiCfg.middlewareAuth(apiCfg.handlerTOTPDisable, auth.ScopeAccount))
+
+	mux.HandleFunc("POST /api/password/forgot", apiCfg.handlerPasswordForgot)
+	mux.HandleFunc("POST /api/password/reset", apiCfg.handlerPasswordReset)
 
 	mux.HandleFunc("POST /api/refresh", apiCfg.handlerRefresh)
 	mux.HandleFunc("POST /api/revoke", apiCfg.handlerRevoke)
+	mux.HandleFunc("POST /api/logout", apiCfg.middlewareAuth(apiCfg.handlerLogout))
+
+	mux.HandleFunc("POST /api/tokens", apiCfg.middlewareAuth(apiCfg.handlerTokensCreate, auth.ScopeAccount))
+	mux.HandleFunc("GET /api/tokens", apiCfg.middlewareAuth(apiCfg.handlerTokensRetrieve, auth.ScopeAccount))
+	mux.HandleFunc("DELETE /api/tokens/{tokenID}", apiCfg.middlewareAuth(apiCfg.handlerTokenDelete, auth.ScopeAccount))
+
+	mux.HandleFunc("POST /api/api-keys", apiCfg.middlewareAuth(apiCfg.handlerAPIKeysCreate, auth.ScopeAccount))
+	mux.HandleFunc("GET /api/api-keys", apiCfg.middlewareAuth(apiCfg.handlerAPIKeysRetrieve, auth.ScopeAccount))
+	mux.HandleFunc("DELETE /api/api-keys/{keyID}", apiCfg.middlewareAuth(apiCfg.handlerAPIKeyDelete, auth.ScopeAccount))
+
+	mux.HandleFunc("GET /api/sessions", apiCfg.middlewareAuth(apiCfg.handlerSessionsRetrieve, auth.ScopeAccount))
+	mux.HandleFunc("DELETE /api/sessions/{sessionID}", apiCfg.middlewareAuth(apiCfg.handlerSessionDelete, auth.ScopeAccount))
+	mux.HandleFunc("POST /api/sessions/revoke-all", apiCfg.middlewareAuth(apiCfg.handlerSessionsRevokeAll, auth.ScopeAccount))
+
+	mux.HandleFunc("PUT /api/follows/{userID}", apiCfg.middlewareAuth(apiCfg.handlerFollowCreate, auth.ScopeProfileWrite))
+	mux.HandleFunc("DELETE /api/follows/{userID}", apiCfg.middlewareAuth(apiCfg.handlerFollowDelete, auth.ScopeProfileWrite))
+
+	mux.HandleFunc("GET /api/blocks", apiCfg.middlewareAuth(apiCfg.handlerBlocksRetrieve, auth.ScopeAccount))
+	mux.HandleFunc("PUT /api/blocks/{userID}", apiCfg.middlewareAuth(apiCfg.handlerBlockCreate, auth.ScopeAccount))
+	mux.HandleFunc("DELETE /api/blocks/{userID}", apiCfg.middlewareAuth(apiCfg.handlerBlockDelete, auth.ScopeAccount))
+
+	mux.HandleFunc("GET /api/audit-events", apiCfg.middlewareAuth(apiCfg.handlerUsersAuditEvents, auth.ScopeAccount))
+
+	mux.HandleFunc("POST /api/oauth/clients", apiCfg.middlewareAuth(apiCfg.handlerOAuthClientsCreate, auth.ScopeAccount))
+	mux.HandleFunc("GET /api/oauth/clients", apiCfg.middlewareAuth(apiCfg.handlerOAuthClientsRetrieve, auth.ScopeAccount))
+	mux.HandleFunc("DELETE /api/oauth/clients/{clientID}", apiCfg.middlewareAuth(apiCfg.handlerOAuthClientDelete, auth.ScopeAccount))
+	mux.HandleFunc("GET /api/oauth/authorize", apiCfg.middlewareAuth(apiCfg.handlerOAuthAuthorizeRetrieve, auth.ScopeAccount))
+	mux.HandleFunc("POST /api/oauth/authorize", apiCfg.middlewareAuth(apiCfg.handlerOAuthAuthorize, auth.ScopeAccount))
+	mux.HandleFunc("POST /oauth/token", apiCfg.oauth.HandleToken)
+	mux.HandleFunc("POST /oauth/revoke", apiCfg.oauth.HandleRevoke)
+
+	mux.HandleFunc("POST /api/conversations", apiCfg.middlewareAuth(apiCfg.handlerConversationsCreate, auth.ScopeMessagesWrite))
+	mux.HandleFunc("GET /api/conversations", apiCfg.middlewareAuth(apiCfg.handlerConversationsRetrieve, auth.ScopeMessagesRead))
+	mux.HandleFunc("POST /api/conversations/{conversationID}/read", apiCfg.middlewareAuth(apiCfg.handlerConversationRead, auth.ScopeMessagesRead))
+	mux.HandleFunc("POST /api/conversations/{conversationID}/messages", apiCfg.middlewareAuth(apiCfg.handlerMessagesCreate, auth.ScopeMessagesWrite))
+	mux.HandleFunc("GET /api/conversations/{conversationID}/messages", apiCfg.middlewareAuth(apiCfg.handlerMessagesRetrieve, auth.ScopeMessagesRead))
+
+	mux.HandleFunc("GET /api/ws", apiCfg.handlerWebSocket)
 
 	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.handlerPolkaWebhook)
 
-	mux.HandleFunc("GET /admin/metrics", apiCfg.handlerMetrics)
-	mux.HandleFunc("POST /admin/reset", apiCfg.handlerReset)
+	mux.HandleFunc("GET /admin/metrics", apiCfg.middlewareRole(apiCfg.handlerMetrics, auth.RoleModerator))
+	mux.HandleFunc("POST /admin/reset", apiCfg.middlewareRole(apiCfg.handlerReset, auth.RoleAdmin))
+	mux.HandleFunc("GET /admin/password-hashes", apiCfg.middlewareRole(apiCfg.handlerAdminPasswordHashes, auth.RoleAdmin))
+	mux.HandleFunc("GET /admin/users", apiCfg.middlewareRole(apiCfg.handlerAdminUsersSearch, auth.RoleAdmin))
+	mux.HandleFunc("GET /admin/users/{userID}", apiCfg.middlewareRole(apiCfg.handlerAdminUserGet, auth.RoleAdmin))
+	mux.HandleFunc("DELETE /admin/users/{userID}", apiCfg.middlewareRole(apiCfg.handlerAdminUserDelete, auth.RoleAdmin))
+	mux.HandleFunc("PUT /admin/users/{userID}/role", apiCfg.middlewareRole(apiCfg.handlerAdminUserRole, auth.RoleAdmin))
+	mux.HandleFunc("POST /admin/users/{userID}/password-reset", apiCfg.middlewareRole(apiCfg.handlerAdminUserPasswordReset, auth.RoleAdmin))
+	mux.HandleFunc("POST /admin/users/{userID}/verify-email", apiCfg.middlewareRole(apiCfg.handlerAdminUserVerifyEmail, auth.RoleAdmin))
+	mux.HandleFunc("PUT /admin/users/{userID}/chirpy-red", apiCfg.middlewareRole(apiCfg.handlerAdminUserChirpyRed, auth.RoleAdmin))
+	mux.HandleFunc("DELETE /admin/users/{userID}/chirpy-red", apiCfg.middlewareRole(apiCfg.handlerAdminUserChirpyRed, auth.RoleAdmin))
+	mux.HandleFunc("POST /admin/users/{userID}/impersonate", apiCfg.middlewareRole(apiCfg.handlerAdminUserImpersonate, auth.RoleAdmin))
+	mux.HandleFunc("GET /admin/audit-events", apiCfg.middlewareRole(apiCfg.handlerAdminAuditEvents, auth.RoleAdmin))
 
 	server := &http.Server{
 		Addr: ":" + port,
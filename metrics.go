@@ -3,10 +3,11 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"github.com/airlangga-hub/chirpy-go/internal/auth"
 )
 
 
-func (cfg *apiConfig) handlerMetrics(w http.ResponseWriter, r *http.Request) {
+func (cfg *apiConfig) handlerMetrics(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
 	w.Header().Add("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(fmt.Sprintf(
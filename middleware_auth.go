@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"github.com/airlangga-hub/chirpy-go/internal/auth"
+)
+
+// authedHandler is a handler that runs only for a valid access token or API
+// key.
+type authedHandler func(w http.ResponseWriter, r *http.Request, claims auth.Claims)
+
+// middlewareAuth validates the bearer access token, or a user API key, and
+// checks it carries every scope in scopes before calling handler. Requests
+// made with an admin's impersonation token are audited, and refused outright
+// where the account scope is needed.
+func (cfg *apiConfig) middlewareAuth(handler authedHandler, scopes ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var claims auth.Claims
+
+		if apiKey, err := auth.GetAPIKey(r.Header); err == nil {
+			claims, err = cfg.authenticateAPIKey(r.Context(), apiKey)
+			if err != nil {
+				respondWithError(w, http.StatusUnauthorized, "Couldn't validate API key", err)
+				return
+			}
+		} else {
+			token, err := auth.GetBearerToken(r.Header)
+			if err != nil {
+				respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+				return
+			}
+
+			claims, err = auth.ValidateJWT(r.Context(), token, cfg.jwtKeys, cfg.revocations)
+			if err != nil {
+				respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+				return
+			}
+		}
+
+		if claims.Impersonated() {
+			r = withImpersonator(r, claims.ActorID)
+			cfg.auditImpersonation(r, claims)
+
+			// Impersonation tokens never carry the account scope, but saying
+			// so plainly beats a missing scope error.
+			if slices.Contains(scopes, auth.ScopeAccount) {
+				respondWithError(w, http.StatusForbidden, "Not allowed while impersonating a user", nil)
+				return
+			}
+		}
+
+		for _, scope := range scopes {
+			if !claims.HasScope(scope) {
+				w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+strings.Join(scopes, " ")+`"`)
+				respondWithError(w, http.StatusForbidden, "Token is missing the "+scope+" scope", nil)
+				return
+			}
+		}
+
+		handler(w, r, claims)
+	}
+}
+
+// middlewareRole runs handler only for a token with the admin scope whose
+// user's role is at least role. The role is read from the database on every
+// request, so a demotion takes effect at once. Only login sessions get
+// through: personal access tokens, API keys, OAuth apps and impersonation
+// tokens carry neither the account nor the admin scope.
+func (cfg *apiConfig) middlewareRole(handler authedHandler, role string) http.HandlerFunc {
+	return cfg.middlewareAuth(func(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
+		user, err := cfg.db.GetUser(r.Context(), claims.UserID)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, "Couldn't get user", err)
+			return
+		}
+
+		if !auth.HasRole(user.Role, role) {
+			respondWithError(w, http.StatusForbidden, "Requires the "+role+" role", nil)
+			return
+		}
+
+		handler(w, r, claims)
+	}, auth.ScopeAccount, auth.ScopeAdmin)
+}
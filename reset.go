@@ -1,8 +1,14 @@
 package main
 
-import "net/http"
+import (
+	"net/http"
+	"github.com/airlangga-hub/chirpy-go/internal/auth"
+)
 
-func (cfg *apiConfig) handlerReset(w http.ResponseWriter, r *http.Request) {
+// handlerReset deletes every user and everything they own. On top of the
+// admin role it still needs PLATFORM=dev, so no admin session can wipe a
+// production database.
+func (cfg *apiConfig) handlerReset(w http.ResponseWriter, r *http.Request, claims auth.Claims) {
 	if cfg.platform != "dev" {
 		w.WriteHeader(http.StatusForbidden)
 		w.Write([]byte("Reset is only allowed in dev environment"))
@@ -18,6 +24,11 @@ func (cfg *apiConfig) handlerReset(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	cfg.audit(r, auditEvent{
+		Action: auditAdminReset,
+		ActorID: claims.UserID,
+	})
+
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Hits reset to 0 and database reset to initial state"))
 }
\ No newline at end of file
@@ -0,0 +1,47 @@
+-- name: CreateAPIKey :one
+INSERT INTO api_keys (
+    id,
+    created_at,
+    user_id,
+    name,
+    key_hash,
+    key_prefix,
+    scopes,
+    expires_at
+)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6
+)
+RETURNING *;
+
+-- name: GetAPIKeyByHash :one
+SELECT * FROM api_keys
+WHERE key_hash = $1
+AND revoked_at IS NULL
+AND (expires_at IS NULL OR expires_at > NOW());
+
+-- name: GetAPIKeysForUser :many
+SELECT * FROM api_keys
+WHERE user_id = $1
+AND revoked_at IS NULL
+ORDER BY created_at DESC;
+
+-- name: TouchAPIKey :exec
+UPDATE api_keys
+SET last_used_at = NOW()
+WHERE id = $1
+AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute');
+
+-- name: RevokeAPIKey :execrows
+UPDATE api_keys
+SET revoked_at = NOW()
+WHERE id = $1
+AND user_id = $2
+AND revoked_at IS NULL;
\ No newline at end of file
@@ -0,0 +1,43 @@
+-- name: CreateAuditEvent :exec
+INSERT INTO audit_events (
+    id,
+    created_at,
+    actor_id,
+    action,
+    target_user_id,
+    ip_address,
+    user_agent,
+    details,
+    diff,
+    impersonator_id
+)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8
+);
+
+-- name: ListAuditEvents :many
+SELECT * FROM audit_events
+WHERE (sqlc.narg(actor_id)::uuid IS NULL OR actor_id = sqlc.narg(actor_id))
+AND (sqlc.narg(target_user_id)::uuid IS NULL OR target_user_id = sqlc.narg(target_user_id))
+AND (sqlc.narg(impersonator_id)::uuid IS NULL OR impersonator_id = sqlc.narg(impersonator_id))
+AND (sqlc.narg(action)::text IS NULL OR action = sqlc.narg(action))
+AND (sqlc.narg(since)::timestamp IS NULL OR created_at >= sqlc.narg(since))
+AND (sqlc.narg(until)::timestamp IS NULL OR created_at < sqlc.narg(until))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(max_results);
+
+-- name: ListAuditEventsForUser :many
+SELECT * FROM audit_events
+WHERE (actor_id = sqlc.arg(user_id)::uuid OR target_user_id = sqlc.arg(user_id)::uuid)
+AND (sqlc.narg(until)::timestamp IS NULL OR created_at < sqlc.narg(until))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(max_results);
\ No newline at end of file
@@ -0,0 +1,41 @@
+-- name: BlockUser :exec
+INSERT INTO blocks (
+    blocker_id,
+    blocked_id,
+    created_at
+)
+VALUES (
+    $1,
+    $2,
+    NOW()
+)
+ON CONFLICT DO NOTHING;
+
+-- name: UnblockUser :exec
+DELETE FROM blocks
+WHERE blocker_id = $1
+AND blocked_id = $2;
+
+-- name: GetBlocks :many
+SELECT *
+FROM blocks
+WHERE blocker_id = $1
+ORDER BY created_at DESC;
+
+-- name: HasBlockBetween :one
+SELECT EXISTS (
+    SELECT 1
+    FROM blocks
+    WHERE blocker_id = ANY(sqlc.arg(user_ids)::uuid[])
+    AND blocked_id = ANY(sqlc.arg(user_ids)::uuid[])
+);
+
+-- name: HasConversationBlock :one
+SELECT EXISTS (
+    SELECT 1
+    FROM blocks
+    JOIN conversation_members blockers ON blockers.user_id = blocks.blocker_id
+    JOIN conversation_members blocked ON blocked.user_id = blocks.blocked_id
+    WHERE blockers.conversation_id = $1
+    AND blocked.conversation_id = $1
+);
\ No newline at end of file
@@ -28,4 +28,9 @@ WHERE id = $1;
 -- name: DeleteChirp :exec
 DELETE FROM chirps
 WHERE id = $1
-AND user_id = $2;
\ No newline at end of file
+AND user_id = $2;
+
+-- name: CountChirpsByUser :one
+SELECT COUNT(*)
+FROM chirps
+WHERE user_id = $1;
\ No newline at end of file
@@ -0,0 +1,144 @@
+-- name: CreateConversation :one
+INSERT INTO conversations (
+    id,
+    created_at,
+    updated_at
+)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW()
+)
+RETURNING *;
+
+-- name: AddConversationMember :exec
+INSERT INTO conversation_members (
+    conversation_id,
+    user_id,
+    joined_at
+)
+VALUES (
+    $1,
+    $2,
+    NOW()
+);
+
+-- name: GetConversation :one
+SELECT *
+FROM conversations
+WHERE id = $1;
+
+-- name: GetDirectConversation :one
+SELECT conversations.*
+FROM direct_conversations
+JOIN conversations ON conversations.id = direct_conversations.conversation_id
+WHERE direct_conversations.user_a_id = LEAST(sqlc.arg(user_id)::uuid, sqlc.arg(other_user_id)::uuid)
+AND direct_conversations.user_b_id = GREATEST(sqlc.arg(user_id)::uuid, sqlc.arg(other_user_id)::uuid);
+
+-- name: CreateDirectConversation :one
+INSERT INTO direct_conversations (
+    user_a_id,
+    user_b_id,
+    conversation_id
+)
+VALUES (
+    LEAST(sqlc.arg(user_id)::uuid, sqlc.arg(other_user_id)::uuid),
+    GREATEST(sqlc.arg(user_id)::uuid, sqlc.arg(other_user_id)::uuid),
+    sqlc.arg(conversation_id)
+)
+ON CONFLICT DO NOTHING
+RETURNING conversation_id;
+
+-- name: IsConversationMember :one
+SELECT EXISTS (
+    SELECT 1
+    FROM conversation_members
+    WHERE conversation_id = $1
+    AND user_id = $2
+);
+
+-- name: GetConversationMembers :many
+SELECT *
+FROM conversation_members
+WHERE conversation_id = $1
+ORDER BY joined_at;
+
+-- name: GetConversationsForUser :many
+SELECT
+    conversations.id,
+    conversations.created_at,
+    conversations.updated_at,
+    last_message.id AS last_message_id,
+    last_message.created_at AS last_message_created_at,
+    last_message.sender_id AS last_message_sender_id,
+    last_message.body AS last_message_body,
+    (
+        SELECT COUNT(*)
+        FROM messages
+        WHERE messages.conversation_id = conversations.id
+        AND messages.sender_id <> conversation_members.user_id
+        AND (
+            conversation_members.last_read_at IS NULL
+            OR messages.created_at > conversation_members.last_read_at
+        )
+    ) AS unread_count
+FROM conversation_members
+JOIN conversations ON conversations.id = conversation_members.conversation_id
+LEFT JOIN LATERAL (
+    SELECT id, created_at, sender_id, body
+    FROM messages
+    WHERE messages.conversation_id = conversations.id
+    ORDER BY created_at DESC
+    LIMIT 1
+) last_message ON true
+WHERE conversation_members.user_id = $1
+ORDER BY conversations.updated_at DESC;
+
+-- name: TouchConversation :exec
+UPDATE conversations
+SET updated_at = NOW()
+WHERE id = $1;
+
+-- name: MarkConversationRead :one
+UPDATE conversation_members
+SET last_read_at = NOW()
+WHERE conversation_id = $1
+AND user_id = $2
+RETURNING *;
+
+-- name: CreateMessage :one
+INSERT INTO messages (
+    id,
+    created_at,
+    conversation_id,
+    sender_id,
+    body
+)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3
+)
+RETURNING *;
+
+-- name: GetMessages :many
+SELECT *
+FROM messages
+WHERE conversation_id = $1
+ORDER BY created_at;
+
+-- name: GetDMRecipients :many
+SELECT
+    users.id,
+    users.dm_policy,
+    EXISTS (
+        SELECT 1
+        FROM follows
+        WHERE follows.follower_id = users.id
+        AND follows.followed_id = sqlc.arg(sender_id)
+    ) AS follows_sender
+FROM users
+WHERE users.id = ANY(sqlc.arg(recipient_ids)::uuid[])
+AND users.id <> sqlc.arg(sender_id);
\ No newline at end of file
@@ -0,0 +1,34 @@
+-- name: CreateEmailVerificationToken :one
+INSERT INTO email_verification_tokens (
+    token_hash,
+    created_at,
+    user_id,
+    email,
+    expires_at
+)
+VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3,
+    $4
+)
+RETURNING *;
+
+-- name: GetEmailVerificationToken :one
+SELECT *
+FROM email_verification_tokens
+WHERE token_hash = $1
+AND used_at IS NULL
+AND expires_at > NOW();
+
+-- name: MarkEmailVerificationTokenUsed :exec
+UPDATE email_verification_tokens
+SET used_at = NOW()
+WHERE token_hash = $1;
+
+-- name: CountEmailVerificationTokensSince :one
+SELECT COUNT(*)
+FROM email_verification_tokens
+WHERE user_id = $1
+AND created_at > $2;
\ No newline at end of file
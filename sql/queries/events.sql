@@ -0,0 +1,24 @@
+-- name: NotifyEvent :exec
+SELECT pg_notify(sqlc.arg(channel)::text, sqlc.arg(payload)::text);
+
+-- name: CreateEventPayload :one
+INSERT INTO event_payloads (
+    id,
+    created_at,
+    payload
+)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1
+)
+RETURNING id;
+
+-- name: GetEventPayload :one
+SELECT payload
+FROM event_payloads
+WHERE id = $1;
+
+-- name: DeleteEventPayloadsBefore :exec
+DELETE FROM event_payloads
+WHERE created_at < $1;
\ No newline at end of file
@@ -0,0 +1,43 @@
+-- name: FollowUser :exec
+INSERT INTO follows (
+    follower_id,
+    followed_id,
+    created_at
+)
+VALUES (
+    $1,
+    $2,
+    NOW()
+)
+ON CONFLICT DO NOTHING;
+
+-- name: UnfollowUser :exec
+DELETE FROM follows
+WHERE follower_id = $1
+AND followed_id = $2;
+
+-- name: DeleteFollowsBetween :exec
+DELETE FROM follows
+WHERE (follower_id = sqlc.arg(user_id) AND followed_id = sqlc.arg(other_user_id))
+OR (follower_id = sqlc.arg(other_user_id) AND followed_id = sqlc.arg(user_id));
+
+-- name: CountFollowers :one
+SELECT COUNT(*)
+FROM follows
+WHERE followed_id = $1;
+
+-- name: CountFollowing :one
+SELECT COUNT(*)
+FROM follows
+WHERE follower_id = $1;
+
+-- name: GetFollowerIDs :many
+SELECT follower_id
+FROM follows
+WHERE followed_id = $1
+AND NOT EXISTS (
+    SELECT 1
+    FROM blocks
+    WHERE (blocker_id = follows.follower_id AND blocked_id = follows.followed_id)
+    OR (blocker_id = follows.followed_id AND blocked_id = follows.follower_id)
+);
\ No newline at end of file
@@ -0,0 +1,58 @@
+-- name: EnsureLoginFailure :exec
+INSERT INTO login_failures (
+    key,
+    failures,
+    first_failure_at,
+    last_failure_at
+)
+VALUES (
+    sqlc.arg(key),
+    0,
+    sqlc.arg(created_at),
+    sqlc.arg(created_at)
+)
+ON CONFLICT (key) DO NOTHING;
+
+-- name: LockLoginFailure :one
+SELECT *
+FROM login_failures
+WHERE key = $1
+FOR UPDATE;
+
+-- name: RecordLoginFailure :one
+INSERT INTO login_failures (
+    key,
+    failures,
+    first_failure_at,
+    last_failure_at
+)
+VALUES (
+    sqlc.arg(key),
+    1,
+    sqlc.arg(failed_at),
+    sqlc.arg(failed_at)
+)
+ON CONFLICT (key) DO UPDATE
+SET failures = CASE
+        WHEN login_failures.last_failure_at < sqlc.arg(reset_before) THEN 1
+        ELSE login_failures.failures + 1
+    END,
+    first_failure_at = CASE
+        WHEN login_failures.last_failure_at < sqlc.arg(reset_before) THEN sqlc.arg(failed_at)
+        ELSE login_failures.first_failure_at
+    END,
+    last_failure_at = sqlc.arg(failed_at)
+RETURNING *;
+
+-- name: ReleaseLoginFailure :exec
+UPDATE login_failures
+SET failures = GREATEST(failures - 1, 0)
+WHERE key = $1;
+
+-- name: ClearLoginFailures :exec
+DELETE FROM login_failures
+WHERE key = $1;
+
+-- name: DeleteStaleLoginFailures :exec
+DELETE FROM login_failures
+WHERE last_failure_at < $1;
\ No newline at end of file
@@ -0,0 +1,30 @@
+-- name: CreateMagicLinkToken :exec
+INSERT INTO magic_link_tokens (
+    token_hash,
+    created_at,
+    user_id,
+    browser_hash,
+    expires_at
+)
+VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3,
+    $4
+);
+
+-- name: RedeemMagicLinkToken :one
+UPDATE magic_link_tokens
+SET used_at = NOW()
+WHERE token_hash = $1
+AND browser_hash = $2
+AND used_at IS NULL
+AND expires_at > NOW()
+RETURNING *;
+
+-- name: CountMagicLinkTokensSince :one
+SELECT COUNT(*)
+FROM magic_link_tokens
+WHERE user_id = $1
+AND created_at > $2;
\ No newline at end of file
@@ -0,0 +1,45 @@
+-- name: SetUserTOTPSecret :exec
+UPDATE users
+SET totp_secret = $1, totp_enabled_at = NULL, updated_at = NOW()
+WHERE id = $2;
+
+-- name: EnableUserTOTP :exec
+UPDATE users
+SET totp_enabled_at = NOW(), totp_last_step = $1, updated_at = NOW()
+WHERE id = $2;
+
+-- name: DisableUserTOTP :exec
+UPDATE users
+SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = 0, updated_at = NOW()
+WHERE id = $1;
+
+-- name: UseTOTPStep :execrows
+UPDATE users
+SET totp_last_step = $1
+WHERE id = $2
+AND totp_last_step < $1;
+
+-- name: CreateRecoveryCode :exec
+INSERT INTO mfa_recovery_codes (
+    id,
+    created_at,
+    user_id,
+    code_hash
+)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2
+);
+
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM mfa_recovery_codes
+WHERE user_id = $1;
+
+-- name: UseRecoveryCode :execrows
+UPDATE mfa_recovery_codes
+SET used_at = NOW()
+WHERE user_id = $1
+AND code_hash = $2
+AND used_at IS NULL;
\ No newline at end of file
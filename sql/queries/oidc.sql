@@ -0,0 +1,57 @@
+-- name: CreateOIDCLoginState :exec
+INSERT INTO oidc_login_states (
+    state_hash,
+    created_at,
+    provider,
+    nonce,
+    code_verifier,
+    expires_at
+)
+VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3,
+    $4,
+    $5
+);
+
+-- name: ConsumeOIDCLoginState :one
+DELETE FROM oidc_login_states
+WHERE state_hash = $1
+AND provider = $2
+AND expires_at > NOW()
+RETURNING *;
+
+-- name: DeleteExpiredOIDCLoginStates :exec
+DELETE FROM oidc_login_states
+WHERE expires_at <= NOW();
+
+-- name: GetUserIdentity :one
+SELECT * FROM user_identities
+WHERE provider = $1
+AND subject = $2;
+
+-- name: CreateUserIdentity :exec
+INSERT INTO user_identities (
+    provider,
+    subject,
+    created_at,
+    user_id,
+    email,
+    last_login_at
+)
+VALUES (
+    $1,
+    $2,
+    NOW(),
+    $3,
+    $4,
+    NOW()
+);
+
+-- name: TouchUserIdentity :exec
+UPDATE user_identities
+SET email = $3, last_login_at = NOW()
+WHERE provider = $1
+AND subject = $2;
\ No newline at end of file
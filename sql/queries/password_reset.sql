@@ -0,0 +1,41 @@
+-- name: CreatePasswordResetToken :one
+INSERT INTO password_reset_tokens (
+    token_hash,
+    created_at,
+    user_id,
+    expires_at
+)
+VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3
+)
+RETURNING *;
+
+-- name: GetPasswordResetToken :one
+SELECT *
+FROM password_reset_tokens
+WHERE token_hash = $1
+AND used_at IS NULL
+AND expires_at > NOW();
+
+-- name: UsePasswordResetToken :one
+UPDATE password_reset_tokens
+SET used_at = NOW()
+WHERE token_hash = $1
+AND used_at IS NULL
+AND expires_at > NOW()
+RETURNING user_id;
+
+-- name: CountPasswordResetTokensSince :one
+SELECT COUNT(*)
+FROM password_reset_tokens
+WHERE user_id = $1
+AND created_at > $2;
+
+-- name: MarkPasswordResetTokensUsed :exec
+UPDATE password_reset_tokens
+SET used_at = NOW()
+WHERE user_id = $1
+AND used_at IS NULL;
\ No newline at end of file
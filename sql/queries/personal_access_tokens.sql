@@ -0,0 +1,33 @@
+-- name: CreatePersonalAccessToken :one
+INSERT INTO personal_access_tokens (
+    id,
+    created_at,
+    user_id,
+    name,
+    scopes,
+    expires_at
+)
+VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3,
+    $4,
+    $5
+)
+RETURNING *;
+
+-- name: GetPersonalAccessTokensForUser :many
+SELECT * FROM personal_access_tokens
+WHERE user_id = $1
+AND revoked_at IS NULL
+AND expires_at > NOW()
+ORDER BY created_at DESC;
+
+-- name: RevokePersonalAccessToken :one
+UPDATE personal_access_tokens
+SET revoked_at = NOW()
+WHERE id = $1
+AND user_id = $2
+AND revoked_at IS NULL
+RETURNING *;
\ No newline at end of file
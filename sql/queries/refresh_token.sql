@@ -1,29 +1,79 @@
 -- name: CreateRefreshToken :one
 INSERT INTO refresh_tokens (
-    token,
+    token_hash,
     created_at,
     updated_at,
     user_id,
-    expires_at
+    expires_at,
+    family_id,
+    user_agent,
+    ip_address,
+    last_used_at,
+    client_id,
+    scopes
 )
 VALUES (
     $1,
     NOW(),
     NOW(),
     $2,
-    $3
+    $3,
+    $4,
+    $5,
+    $6,
+    NOW(),
+    $7,
+    $8
 )
 RETURNING *;
 
--- name: RevokeRefreshToken :one
+-- name: GetRefreshToken :one
+SELECT * FROM refresh_tokens
+WHERE token_hash = $1;
+
+-- name: RotateRefreshToken :execrows
+UPDATE refresh_tokens
+SET rotated_at = NOW(), last_used_at = NOW(), updated_at = NOW()
+WHERE token_hash = $1
+AND rotated_at IS NULL
+AND revoked_at IS NULL
+AND expires_at > NOW();
+
+-- name: RevokeRefreshTokenFamily :exec
 UPDATE refresh_tokens
 SET revoked_at = NOW(), updated_at = NOW()
-WHERE token = $1
-RETURNING *;
+WHERE family_id = $1
+AND revoked_at IS NULL;
 
--- name: GetUserByRefreshToken :one
-SELECT users.* FROM users
-JOIN refresh_tokens ON users.id = refresh_tokens.user_id
-WHERE token = $1
-AND revoked_at IS NULL
-AND expires_at > NOW();
\ No newline at end of file
+-- name: RevokeAllRefreshTokensForUser :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1
+AND revoked_at IS NULL;
+
+-- name: GetSessionsForUser :many
+SELECT
+    refresh_tokens.family_id,
+    sessions.signed_in_at::timestamp AS signed_in_at,
+    refresh_tokens.last_used_at,
+    refresh_tokens.expires_at,
+    refresh_tokens.user_agent,
+    refresh_tokens.ip_address
+FROM refresh_tokens
+JOIN (
+    SELECT family_id, MIN(created_at) AS signed_in_at
+    FROM refresh_tokens
+    GROUP BY family_id
+) AS sessions ON sessions.family_id = refresh_tokens.family_id
+WHERE refresh_tokens.user_id = $1
+AND refresh_tokens.rotated_at IS NULL
+AND refresh_tokens.revoked_at IS NULL
+AND refresh_tokens.expires_at > NOW()
+ORDER BY refresh_tokens.last_used_at DESC;
+
+-- name: RevokeSession :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE family_id = $1
+AND user_id = $2
+AND revoked_at IS NULL;
\ No newline at end of file
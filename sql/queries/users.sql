@@ -4,14 +4,16 @@ INSERT INTO users (
     created_at,
     updated_at,
     email,
-    hashed_password
+    hashed_password,
+    handle
 )
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    $3
 )
 RETURNING *;
 
@@ -22,11 +24,103 @@ WHERE email = $1;
 
 -- name: UpdateUser :one
 UPDATE users
-SET email = $1, hashed_password = $2, updated_at = NOW()
-WHERE id = $3
+SET handle = $1,
+    display_name = $2,
+    bio = $3,
+    location = $4,
+    website = $5,
+    dm_policy = $6,
+    updated_at = NOW()
+WHERE id = $7
 RETURNING *;
 
--- name: UpdateUserChirpyRed :exec
+-- name: GetUser :one
+SELECT *
+FROM users
+WHERE id = $1;
+
+-- name: GetUserByHandle :one
+SELECT *
+FROM users
+WHERE LOWER(handle) = LOWER(sqlc.arg(handle));
+
+-- name: UpdateUserAvatar :one
+UPDATE users
+SET avatar_key = $1, updated_at = NOW()
+WHERE id = $2
+RETURNING *;
+
+-- name: UpdateUserBanner :one
+UPDATE users
+SET banner_key = $1, updated_at = NOW()
+WHERE id = $2
+RETURNING *;
+
+-- name: VerifyUserEmail :one
+UPDATE users
+SET email = sqlc.arg(email),
+    pending_email = NULL,
+    email_verified_at = NOW(),
+    updated_at = NOW()
+WHERE id = sqlc.arg(id)
+AND (email = sqlc.arg(email) OR pending_email = sqlc.arg(email))
+RETURNING *;
+
+-- name: UpdateUserPassword :exec
+UPDATE users
+SET hashed_password = $1, updated_at = NOW()
+WHERE id = $2;
+
+-- name: SetUserPendingEmail :one
 UPDATE users
-SET is_chirpy_red = true, updated_at = NOW()
+SET pending_email = $1, updated_at = NOW()
+WHERE id = $2
+RETURNING *;
+
+-- name: GetUserTokensValidAfter :one
+SELECT tokens_valid_after FROM users
+WHERE id = $1;
+
+-- name: SetUserTokensValidAfter :exec
+UPDATE users
+SET tokens_valid_after = GREATEST(tokens_valid_after, sqlc.arg(tokens_valid_after)::timestamp), updated_at = NOW()
+WHERE id = sqlc.arg(id);
+
+-- name: RehashUserPassword :exec
+UPDATE users
+SET hashed_password = sqlc.arg(new_hash)
+WHERE id = sqlc.arg(id)
+AND hashed_password = sqlc.arg(old_hash);
+
+-- name: CountPasswordHashesByParams :many
+SELECT split_part(hashed_password, '$', 4) AS params, COUNT(*) AS users
+FROM users
+GROUP BY params
+ORDER BY users DESC;
+
+-- name: SetUserRole :one
+UPDATE users
+SET role = $1, updated_at = NOW()
+WHERE id = $2
+RETURNING *;
+
+-- name: CountUsersWithRole :one
+SELECT COUNT(*) FROM users
+WHERE role = $1;
+
+-- name: SearchUsers :many
+SELECT * FROM users
+WHERE email ILIKE sqlc.arg(pattern)
+OR handle ILIKE sqlc.arg(pattern)
+ORDER BY created_at DESC
+LIMIT sqlc.arg(max_results);
+
+-- name: SetUserChirpyRed :one
+UPDATE users
+SET is_chirpy_red = $1, updated_at = NOW()
+WHERE id = $2
+RETURNING *;
+
+-- name: DeleteUser :execrows
+DELETE FROM users
 WHERE id = $1;
\ No newline at end of file
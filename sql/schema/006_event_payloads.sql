@@ -0,0 +1,9 @@
+-- +goose Up
+CREATE TABLE event_payloads (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    payload TEXT NOT NULL
+);
+
+-- +goose Down
+DROP TABLE event_payloads;
\ No newline at end of file
@@ -0,0 +1,25 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN handle TEXT,
+ADD COLUMN display_name TEXT NOT NULL DEFAULT '',
+ADD COLUMN bio TEXT NOT NULL DEFAULT '',
+ADD COLUMN location TEXT NOT NULL DEFAULT '',
+ADD COLUMN website TEXT NOT NULL DEFAULT '';
+
+UPDATE users
+SET handle = 'user_' || substr(replace(id::text, '-', ''), 1, 10);
+
+ALTER TABLE users
+ALTER COLUMN handle SET NOT NULL;
+
+CREATE UNIQUE INDEX users_handle_lower_idx ON users (LOWER(handle));
+
+-- +goose Down
+DROP INDEX users_handle_lower_idx;
+
+ALTER TABLE users
+DROP COLUMN handle,
+DROP COLUMN display_name,
+DROP COLUMN bio,
+DROP COLUMN location,
+DROP COLUMN website;
\ No newline at end of file
@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN avatar_key TEXT NOT NULL DEFAULT '',
+ADD COLUMN banner_key TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN avatar_key,
+DROP COLUMN banner_key;
\ No newline at end of file
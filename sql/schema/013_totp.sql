@@ -0,0 +1,22 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN totp_secret TEXT,
+ADD COLUMN totp_enabled_at TIMESTAMP,
+ADD COLUMN totp_last_step BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE mfa_recovery_codes (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    used_at TIMESTAMP,
+    UNIQUE (user_id, code_hash)
+);
+
+-- +goose Down
+DROP TABLE mfa_recovery_codes;
+
+ALTER TABLE users
+DROP COLUMN totp_secret,
+DROP COLUMN totp_enabled_at,
+DROP COLUMN totp_last_step;
\ No newline at end of file
@@ -0,0 +1,28 @@
+-- +goose Up
+ALTER TABLE refresh_tokens RENAME COLUMN token TO token_hash;
+
+UPDATE refresh_tokens
+SET token_hash = encode(sha256(convert_to(token_hash, 'UTF8')), 'hex');
+
+ALTER TABLE refresh_tokens
+ADD COLUMN family_id UUID,
+ADD COLUMN rotated_at TIMESTAMP;
+
+UPDATE refresh_tokens SET family_id = gen_random_uuid();
+
+ALTER TABLE refresh_tokens ALTER COLUMN family_id SET NOT NULL;
+
+CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+
+-- +goose Down
+-- Hashed tokens can't be turned back into bearer tokens, so every session
+-- is dropped.
+DELETE FROM refresh_tokens;
+
+DROP INDEX refresh_tokens_family_id_idx;
+
+ALTER TABLE refresh_tokens
+DROP COLUMN family_id,
+DROP COLUMN rotated_at;
+
+ALTER TABLE refresh_tokens RENAME COLUMN token_hash TO token;
\ No newline at end of file
@@ -0,0 +1,21 @@
+-- +goose Up
+ALTER TABLE refresh_tokens
+ADD COLUMN user_agent TEXT NOT NULL DEFAULT '',
+ADD COLUMN ip_address TEXT NOT NULL DEFAULT '',
+ADD COLUMN last_used_at TIMESTAMP;
+
+UPDATE refresh_tokens SET last_used_at = updated_at;
+
+ALTER TABLE refresh_tokens ALTER COLUMN last_used_at SET NOT NULL;
+
+ALTER TABLE users
+ADD COLUMN tokens_valid_after TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN tokens_valid_after;
+
+ALTER TABLE refresh_tokens
+DROP COLUMN user_agent,
+DROP COLUMN ip_address,
+DROP COLUMN last_used_at;
\ No newline at end of file
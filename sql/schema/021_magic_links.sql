@@ -0,0 +1,14 @@
+-- +goose Up
+CREATE TABLE magic_link_tokens (
+    token_hash TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    browser_hash TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP
+);
+
+CREATE INDEX magic_link_tokens_user_id_idx ON magic_link_tokens (user_id);
+
+-- +goose Down
+DROP TABLE magic_link_tokens;
\ No newline at end of file
@@ -0,0 +1,20 @@
+-- +goose Up
+-- Events keep plain IDs rather than foreign keys so the trail outlives the
+-- accounts it mentions.
+CREATE TABLE audit_events (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    actor_id UUID,
+    action TEXT NOT NULL,
+    target_user_id UUID,
+    ip_address TEXT NOT NULL,
+    user_agent TEXT NOT NULL,
+    details JSONB NOT NULL
+);
+
+CREATE INDEX audit_events_actor_id_idx ON audit_events (actor_id, created_at);
+CREATE INDEX audit_events_target_user_id_idx ON audit_events (target_user_id, created_at);
+CREATE INDEX audit_events_action_idx ON audit_events (action, created_at);
+
+-- +goose Down
+DROP TABLE audit_events;
\ No newline at end of file
@@ -0,0 +1,8 @@
+-- +goose Up
+-- diff holds the fields an event changed, each as {"from": ..., "to": ...}.
+ALTER TABLE audit_events
+ADD COLUMN diff JSONB NOT NULL DEFAULT '{}';
+
+-- +goose Down
+ALTER TABLE audit_events
+DROP COLUMN diff;
\ No newline at end of file
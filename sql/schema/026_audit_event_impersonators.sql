@@ -0,0 +1,12 @@
+-- +goose Up
+-- impersonator_id is the admin behind an impersonation token, on every event
+-- recorded while it was used.
+ALTER TABLE audit_events
+ADD COLUMN impersonator_id UUID;
+
+CREATE INDEX audit_events_impersonator_id_idx ON audit_events (impersonator_id, created_at)
+WHERE impersonator_id IS NOT NULL;
+
+-- +goose Down
+ALTER TABLE audit_events
+DROP COLUMN impersonator_id;
\ No newline at end of file
@@ -0,0 +1,23 @@
+-- +goose Up
+CREATE TABLE direct_conversations (
+    user_a_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    user_b_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    conversation_id UUID NOT NULL UNIQUE REFERENCES conversations(id) ON DELETE CASCADE,
+    PRIMARY KEY (user_a_id, user_b_id),
+    CHECK (user_a_id < user_b_id)
+);
+
+INSERT INTO direct_conversations (user_a_id, user_b_id, conversation_id)
+SELECT DISTINCT ON (a.user_id, b.user_id) a.user_id, b.user_id, a.conversation_id
+FROM conversation_members a
+JOIN conversation_members b ON b.conversation_id = a.conversation_id AND a.user_id < b.user_id
+JOIN conversations ON conversations.id = a.conversation_id
+WHERE (
+    SELECT COUNT(*)
+    FROM conversation_members m
+    WHERE m.conversation_id = a.conversation_id
+) = 2
+ORDER BY a.user_id, b.user_id, conversations.created_at;
+
+-- +goose Down
+DROP TABLE direct_conversations;
\ No newline at end of file
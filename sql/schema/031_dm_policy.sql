@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN dm_policy TEXT NOT NULL DEFAULT 'everyone'
+CHECK (dm_policy IN ('everyone', 'following'));
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN dm_policy;
\ No newline at end of file
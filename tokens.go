@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+	"github.com/airlangga-hub/chirpy-go/internal/auth"
+	"github.com/airlangga-hub/chirpy-go/internal/database"
+	"github.com/airlangga-hub/chirpy-go/internal/oauth"
+	"github.com/google/uuid"
+)
+
+const (
+	accessTokenTTL = time.Hour
+	refreshTokenTTL = 60 * 24 * time.Hour
+)
+
+// issueTokens creates a new session for userID and returns its access and
+// refresh tokens, the same pair handlerLogin hands out.
+func (cfg *apiConfig) issueTokens(r *http.Request, userID uuid.UUID) (string, string, error) {
+	accessToken, err := auth.MakeJWT(userID, cfg.jwtKeys, accessTokenTTL)
+	if err != nil {
+		return "", "", err
+	}
+
+	refreshToken, err := createRefreshToken(r, cfg.db, userID, uuid.New(), uuid.NullUUID{}, nil)
+	if err != nil {
+		return "", "", err
+	}
+
+	return accessToken, refreshToken, nil
+}
+
+// createRefreshToken stores the hash of a new refresh token in familyID.
+// Every token rotated out of the same login shares a family, so reuse of an
+// old one can revoke them all. Tokens issued to an OAuth client record the
+// client and the scopes it was granted; login sessions have neither.
+func createRefreshToken(r *http.Request, db *database.Queries, userID, familyID uuid.UUID, clientID uuid.NullUUID, scopes []string) (string, error) {
+	refreshToken := auth.MakeRefreshToken()
+
+	_, err := db.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+		TokenHash: auth.HashToken(refreshToken),
+		UserID: userID,
+		ExpiresAt: time.Now().UTC().Add(refreshTokenTTL),
+		FamilyID: familyID,
+		UserAgent: r.UserAgent(),
+		IpAddress: clientIP(r),
+		ClientID: clientID,
+		Scopes: scopes,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return refreshToken, nil
+}
+
+var errInvalidRefreshToken = errors.New("Invalid refresh token")
+
+// rotateRefreshToken swaps refreshToken for a new one in the same family and
+// returns the old token's row with the new token. The token must have been
+// issued to clientID; login sessions have no client. Presenting a token that
+// was already rotated is treated as theft and revokes the whole family.
+func (cfg *apiConfig) rotateRefreshToken(r *http.Request, refreshToken string, clientID uuid.NullUUID) (database.RefreshToken, string, error) {
+	tokenHash := auth.HashToken(refreshToken)
+
+	dbToken, err := cfg.db.GetRefreshToken(r.Context(), tokenHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return database.RefreshToken{}, "", errInvalidRefreshToken
+		}
+		return database.RefreshToken{}, "", err
+	}
+	if dbToken.ClientID != clientID {
+		return database.RefreshToken{}, "", errInvalidRefreshToken
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		return database.RefreshToken{}, "", err
+	}
+	defer tx.Rollback()
+
+	qtx := cfg.db.WithTx(tx)
+
+	rotated, err := qtx.RotateRefreshToken(r.Context(), tokenHash)
+	if err != nil {
+		return database.RefreshToken{}, "", err
+	}
+
+	if rotated == 0 {
+		tx.Rollback()
+
+		// Either the token was already rotated (possibly by a concurrent
+		// request that won the race) or it's revoked or expired. Only the
+		// first case is reuse.
+		dbToken, err = cfg.db.GetRefreshToken(r.Context(), tokenHash)
+		if err == nil && dbToken.RotatedAt.Valid && !dbToken.RevokedAt.Valid {
+			log.Printf("Refresh token reuse detected for user %s, revoking family %s", dbToken.UserID, dbToken.FamilyID)
+			if err := cfg.db.RevokeRefreshTokenFamily(r.Context(), dbToken.FamilyID); err != nil {
+				return database.RefreshToken{}, "", err
+			}
+		}
+		return database.RefreshToken{}, "", errInvalidRefreshToken
+	}
+
+	newRefreshToken, err := createRefreshToken(r, qtx, dbToken.UserID, dbToken.FamilyID, dbToken.ClientID, dbToken.Scopes)
+	if err != nil {
+		return database.RefreshToken{}, "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return database.RefreshToken{}, "", err
+	}
+
+	return dbToken, newRefreshToken, nil
+}
+
+// revokeAllAccessTokens invalidates every access token and API key userID
+// holds right now. JWT issue times only have second precision, so the
+// watermark is truncated to the second and tokens issued in that second stay
+// valid. Rounding up instead would refuse every login for the rest of the
+// second, including the new session a password change hands out.
+func (cfg *apiConfig) revokeAllAccessTokens(ctx context.Context, userID uuid.UUID) error {
+	return cfg.revocations.RevokeUserTokens(ctx, userID, time.Now().Truncate(time.Second))
+}
+
+// oauthIssuer hands tokens to OAuth clients with the same machinery as login:
+// scoped access tokens and rotating refresh tokens, bound to the client.
+type oauthIssuer struct {
+	cfg *apiConfig
+}
+
+func (o oauthIssuer) IssueTokens(r *http.Request, clientID, userID uuid.UUID, scopes []string) (oauth.Tokens, error) {
+	accessToken, err := auth.MakeScopedJWT(userID, o.cfg.jwtKeys, accessTokenTTL, uuid.NewString(), scopes)
+	if err != nil {
+		return oauth.Tokens{}, err
+	}
+
+	refreshToken, err := createRefreshToken(r, o.cfg.db, userID, uuid.New(), uuid.NullUUID{UUID: clientID, Valid: true}, scopes)
+	if err != nil {
+		return oauth.Tokens{}, err
+	}
+
+	return oauth.Tokens{
+		AccessToken: accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn: accessTokenTTL,
+		Scopes: scopes,
+	}, nil
+}
+
+func (o oauthIssuer) RefreshTokens(r *http.Request, clientID uuid.UUID, refreshToken string) (oauth.Tokens, error) {
+	dbToken, newRefreshToken, err := o.cfg.rotateRefreshToken(r, refreshToken, uuid.NullUUID{UUID: clientID, Valid: true})
+	if err != nil {
+		if errors.Is(err, errInvalidRefreshToken) {
+			return oauth.Tokens{}, oauth.ErrInvalidGrant
+		}
+		return oauth.Tokens{}, err
+	}
+
+	accessToken, err := auth.MakeScopedJWT(dbToken.UserID, o.cfg.jwtKeys, accessTokenTTL, uuid.NewString(), dbToken.Scopes)
+	if err != nil {
+		return oauth.Tokens{}, err
+	}
+
+	return oauth.Tokens{
+		AccessToken: accessToken,
+		RefreshToken: newRefreshToken,
+		ExpiresIn: accessTokenTTL,
+		Scopes: dbToken.Scopes,
+	}, nil
+}
+
+// RevokeToken revokes a refresh token's whole family if it belongs to the
+// client, or an access token's jti. Access tokens don't record their client,
+// but anyone holding one could use it anyway.
+func (o oauthIssuer) RevokeToken(r *http.Request, clientID uuid.UUID, token string) error {
+	dbToken, err := o.cfg.db.GetRefreshToken(r.Context(), auth.HashToken(token))
+	if err == nil {
+		if dbToken.ClientID != (uuid.NullUUID{UUID: clientID, Valid: true}) {
+			return nil
+		}
+		return o.cfg.db.RevokeRefreshTokenFamily(r.Context(), dbToken.FamilyID)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	claims, err := auth.ParseJWT(token, o.cfg.jwtKeys)
+	if err != nil || claims.ID == "" {
+		return nil
+	}
+	return o.cfg.revocations.RevokeToken(r.Context(), claims.ID, claims.ExpiresAt)
+}